@@ -0,0 +1,41 @@
+import { SortableIDGenerator } from '../src/sortable-id';
+import type { BufferPool } from '../src/sortable-id';
+
+// Compares generate() and sample() (which draw a scratch buffer per ID) with and without a caller-provided
+// buffer pool, reporting throughput and the heap allocated per operation
+const ROUNDS = 2_000;
+const BATCH = 100;
+
+function simplePool(): BufferPool {
+    const free: Uint8Array[] = [];
+    return {
+        get: size => {
+            const buffer = free.pop();
+            return buffer && buffer.length >= size ? buffer : new Uint8Array(size);
+        },
+        put: buffer => { free.push(buffer); }
+    };
+}
+
+function measure(name: string, generateBatch: () => void) {
+    generateBatch();  // Warm up
+    const heapBefore = process.memoryUsage().heapUsed;
+    const start = process.hrtime.bigint();
+    for (let i = 0; i < ROUNDS; i++) {
+        generateBatch();
+    }
+    const elapsedMs = Number(process.hrtime.bigint() - start) / 1e6;
+    const ops = ROUNDS * BATCH;
+    const bytesPerOp = (process.memoryUsage().heapUsed - heapBefore) / ops;
+    console.log(`${name}: ${Math.round(ops / elapsedMs * 1000).toLocaleString()} ops/s, ~${Math.max(0, Math.round(bytesPerOp))} heap bytes/op`);
+}
+
+for (const [label, bufferPool] of [['internal buffers', undefined], ['buffer pool', simplePool()]] as const) {
+    const generator = new SortableIDGenerator({ totalLength: 32, bufferPool });
+    measure(`generate(), ${label}`, () => {
+        for (let i = 0; i < BATCH; i++) {
+            generator.generate();
+        }
+    });
+    measure(`sample(), ${label}`, () => generator.sample(BATCH));
+}
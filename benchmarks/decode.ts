@@ -0,0 +1,88 @@
+import { SortableIDGenerator } from '../src/sortable-id';
+
+// Compares the character work decode does (validating every character, then reading the timestamp)
+// using linear alphabet scans, as decode did before, against the generator's lookup table, reporting
+// throughput and the heap allocated per operation. Run with node --expose-gc (npm run bench does): it then
+// fails with a non-zero exit if decodeTimespanFast allocates
+const ROUNDS = 500_000;
+// Few enough that even a handful of bytes per call can't trigger a collection mid-loop and hide itself.
+// The best of several trials is kept, as the first ones also count the JIT's own allocations.
+const ALLOCATION_ROUNDS = 10_000;
+const ALLOCATION_TRIALS = 5;
+const MAX_FAST_BYTES_PER_OP = 1;
+
+const gc = (globalThis as { gc?: () => void }).gc;
+
+const generator = new SortableIDGenerator({ totalLength: 64 });
+const id = generator.generate();
+const alphabet: string = generator['alphabet'];
+const timestampLength: number = generator['timestampLength'];
+
+function scanDecode(): number {
+    if ([...id].some(char => !alphabet.includes(char))) {
+        throw new Error('ID contains invalid characters');
+    }
+    let timestamp = 0;
+    for (let i = 0; i < timestampLength; i++) {
+        timestamp = timestamp * alphabet.length + alphabet.indexOf(id[i]);
+    }
+    return timestamp;
+}
+
+function tableDecode(): number {
+    if ([...id].some(char => generator['indexOf'](char) < 0)) {
+        throw new Error('ID contains invalid characters');
+    }
+    let timestamp = 0;
+    for (let i = 0; i < timestampLength; i++) {
+        timestamp = timestamp * alphabet.length + generator['indexOf'](id[i]);
+    }
+    return timestamp;
+}
+
+function measure(name: string, fn: () => void) {
+    fn();  // Warm up
+    const heapBefore = process.memoryUsage().heapUsed;
+    const start = process.hrtime.bigint();
+    for (let i = 0; i < ROUNDS; i++) {
+        fn();
+    }
+    const elapsedMs = Number(process.hrtime.bigint() - start) / 1e6;
+    const bytesPerOp = (process.memoryUsage().heapUsed - heapBefore) / ROUNDS;
+    console.log(`${name}: ${Math.round(ROUNDS / elapsedMs * 1000).toLocaleString()} ops/s, ~${Math.max(0, Math.round(bytesPerOp))} heap bytes/op`);
+}
+
+measure('linear scan', scanDecode);
+measure('lookup table', tableDecode);
+measure('decode()', () => generator.decode(id));
+measure('decodeTimespanFast()', () => generator.decodeTimespanFast(id));
+
+// Smallest heap growth per call over short loops, each starting from a collected heap
+function allocatedBytesPerOp(fn: () => void, collect: () => void): number {
+    let best = Infinity;
+    for (let trial = 0; trial < ALLOCATION_TRIALS; trial++) {
+        for (let i = 0; i < ALLOCATION_ROUNDS; i++) {
+            fn();  // Warm up
+        }
+        collect();
+        const heapBefore = process.memoryUsage().heapUsed;
+        for (let i = 0; i < ALLOCATION_ROUNDS; i++) {
+            fn();
+        }
+        best = Math.min(best, (process.memoryUsage().heapUsed - heapBefore) / ALLOCATION_ROUNDS);
+    }
+    return best;
+}
+
+if (!gc) {
+    console.error('decodeTimespanFast() allocation check needs node --expose-gc');
+    process.exitCode = 1;
+} else {
+    const bytesPerOp = allocatedBytesPerOp(() => generator.decodeTimespanFast(id), gc);
+    if (bytesPerOp > MAX_FAST_BYTES_PER_OP) {
+        console.error(`decodeTimespanFast() allocates ~${bytesPerOp.toFixed(1)} heap bytes/op, expected none`);
+        process.exitCode = 1;
+    } else {
+        console.log('decodeTimespanFast() allocation check passed');
+    }
+}
@@ -0,0 +1,20 @@
+import { TypedGenerator } from '../src/typed';
+import type { TypedID } from '../src/typed';
+
+type UserID = TypedID<'user'>;
+type OrderID = TypedID<'order'>;
+
+const users = new TypedGenerator<'user'>();
+const orders = new TypedGenerator<'order'>();
+
+function loadOrder(id: OrderID): void {
+    console.log('Loading order', id);
+}
+
+const userId: UserID = users.generate();
+const orderId: OrderID = orders.generate();
+
+loadOrder(orderId);
+
+// @ts-expect-error a UserID is not an OrderID, even though both are strings at runtime
+loadOrder(userId);
@@ -0,0 +1,67 @@
+// Contexts an ID may need to be embedded in
+export enum AlphabetContext {
+    DNS = "dns",              // DNS labels (hostnames)
+    Filename = "filename",    // File names, including case-insensitive filesystems (Windows, macOS)
+    URLPath = "url_path"      // URL path segments, without percent-encoding
+}
+
+// Lowercase letters and digits: DNS is case-insensitive and only allows '-' in the middle of a label
+export const ALPHABET_DNS_SAFE = '0123456789abcdefghijklmnopqrstuvwxyz';
+
+// Single-case so IDs stay distinct on case-insensitive filesystems; no leading '-' to be mistaken for a CLI flag
+export const ALPHABET_FILENAME_SAFE = '0123456789_abcdefghijklmnopqrstuvwxyz';
+
+// RFC 3986 unreserved characters minus '.' and '~' (same as the default alphabet)
+export const ALPHABET_URL_PATH_SAFE = '-0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ_abcdefghijklmnopqrstuvwxyz';
+
+export const ALPHABET_HEX = '0123456789abcdef';
+
+export const ALPHABET_BASE62 = '0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz';
+
+// Crockford's Base32, as used by ULID: no I, L, O or U
+export const ALPHABET_CROCKFORD_BASE32 = '0123456789ABCDEFGHJKMNPQRSTVWXYZ';
+
+const ALLOWED_CHARS: Record<AlphabetContext, RegExp> = {
+    [AlphabetContext.DNS]: /^[a-z0-9-]$/,
+    [AlphabetContext.Filename]: /^[A-Za-z0-9_-]$/,
+    [AlphabetContext.URLPath]: /^[A-Za-z0-9_~-]$/
+};
+
+export function validateAlphabetForContext(alphabet: string, context: AlphabetContext): void {
+    const allowed = ALLOWED_CHARS[context];
+    if (!allowed) {
+        throw new Error(`Unknown alphabet context: ${context}`);
+    }
+
+    const invalid = [...alphabet].filter(char => !allowed.test(char));
+    if (invalid.length > 0) {
+        throw new Error(`Alphabet contains characters not safe for ${context}: ${[...new Set(invalid)].join('')}`);
+    }
+
+    // The smallest character pads the timestamp, so every early ID starts with it
+    const minChar = [...alphabet].sort()[0];
+    if (minChar === '-' && context !== AlphabetContext.URLPath) {
+        throw new Error(`Alphabet's smallest character '-' would lead every ID, which is not safe for ${context}`);
+    }
+
+    if (context === AlphabetContext.Filename) {
+        const lower = new Set<string>();
+        for (const char of alphabet) {
+            const folded = char.toLowerCase();
+            if (lower.has(folded)) {
+                throw new Error(`Alphabet contains '${char}' in both cases, which collide on case-insensitive filesystems`);
+            }
+            lower.add(folded);
+        }
+    }
+}
+
+// Throws if any character of `separators` also appears in `alphabet`, which would make decoding ambiguous.
+// For characters inserted between an ID's alphabet characters; groupSeparator is the only such setting. (Version
+// and node prefixes are alphabet characters by design, and composite keys are split by length, not a separator.)
+export function assertDisjoint(alphabet: string, separators: string, name: string = 'Separator'): void {
+    const collisions = [...new Set(separators)].filter(char => alphabet.includes(char));
+    if (collisions.length > 0) {
+        throw new Error(`${name} must not contain alphabet characters: ${collisions.join('')}`);
+    }
+}
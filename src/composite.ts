@@ -0,0 +1,27 @@
+// Helpers for composite keys built from several fixed-length IDs (e.g. tenant ID + global ID)
+
+export function concat(...ids: string[]): string {
+    return ids.join('');
+}
+
+export function splitConcat(value: string, ...lengths: number[]): string[] {
+    if (lengths.length === 0) {
+        throw new Error('At least one segment length is required');
+    }
+    if (lengths.some(length => !Number.isInteger(length) || length <= 0)) {
+        throw new Error('Segment lengths must be positive integers');
+    }
+
+    const expectedLength = lengths.reduce((sum, length) => sum + length, 0);
+    if (value.length !== expectedLength) {
+        throw new Error(`Composite ID must be exactly ${expectedLength} characters long (got ${value.length})`);
+    }
+
+    const segments: string[] = [];
+    let offset = 0;
+    for (const length of lengths) {
+        segments.push(value.slice(offset, offset + length));
+        offset += length;
+    }
+    return segments;
+}
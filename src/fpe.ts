@@ -0,0 +1,143 @@
+import { createCipheriv } from 'crypto';
+
+// FF1 format-preserving encryption (NIST SP 800-38G) over strings of numerals 0 to radix-1, with AES as
+// the block cipher. Output has the same length and radix as the input.
+
+const ROUNDS = 10;
+const BLOCK = 16;
+
+export function validateFF1Key(key: Uint8Array): void {
+    if (!(key instanceof Uint8Array) || (key.length !== 16 && key.length !== 24 && key.length !== 32)) {
+        throw new Error('Encryption key must be 16, 24 or 32 bytes (AES-128, AES-192 or AES-256)');
+    }
+}
+
+function aesName(key: Uint8Array, mode: string): string {
+    validateFF1Key(key);
+    return `aes-${key.length * 8}-${mode}`;
+}
+
+// Smallest length FF1 accepts for radix (the standard requires radix^length >= 1,000,000)
+export function ff1MinLength(radix: number): number {
+    let length = 2;
+    while (radix ** length < 1_000_000) {
+        length++;
+    }
+    return length;
+}
+
+function validate(key: Uint8Array, radix: number, numerals: number[]): void {
+    aesName(key, 'ecb');
+    if (!Number.isInteger(radix) || radix < 2 || radix > 2 ** 16) {
+        throw new Error('FF1 radix must be an integer from 2 to 65536');
+    }
+    if (numerals.length < ff1MinLength(radix)) {
+        throw new Error(`FF1 needs at least ${ff1MinLength(radix)} numerals in radix ${radix}`);
+    }
+}
+
+function toNumber(numerals: number[], radix: number): bigint {
+    const r = BigInt(radix);
+    return numerals.reduce((value, numeral) => value * r + BigInt(numeral), BigInt(0));
+}
+
+function toNumerals(value: bigint, radix: number, length: number): number[] {
+    const r = BigInt(radix);
+    const numerals = new Array<number>(length);
+    for (let i = length - 1; i >= 0; i--) {
+        numerals[i] = Number(value % r);
+        value /= r;
+    }
+    return numerals;
+}
+
+// Big-endian byte string of value, exactly length bytes
+function toBytes(value: bigint | number, length: number): Buffer {
+    let v = BigInt(value);
+    const bytes = Buffer.alloc(length);
+    for (let i = length - 1; i >= 0; i--) {
+        bytes[i] = Number(v & BigInt(0xff));
+        v >>= BigInt(8);
+    }
+    return bytes;
+}
+
+class FF1 {
+    private readonly u: number;
+    private readonly v: number;
+    private readonly b: number;
+    private readonly d: number;
+    private readonly p: Buffer;
+
+    constructor(private readonly key: Uint8Array, private readonly radix: number, n: number, private readonly tweak: Uint8Array) {
+        this.u = Math.floor(n / 2);
+        this.v = n - this.u;
+        this.b = Math.ceil(Math.ceil(this.v * Math.log2(radix)) / 8);
+        this.d = 4 * Math.ceil(this.b / 4) + 4;
+        this.p = Buffer.concat([
+            Buffer.from([1, 2, 1]), toBytes(radix, 3), Buffer.from([ROUNDS, this.u % 256]), toBytes(n, 4), toBytes(tweak.length, 4)
+        ]);
+    }
+
+    // Round function output y for round i over the numerals of the unchanged half
+    private round(i: number, half: number[]): bigint {
+        const t = this.tweak.length;
+        const padding = (((-t - this.b - 1) % BLOCK) + BLOCK) % BLOCK;
+        const q = Buffer.concat([
+            Buffer.from(this.tweak), Buffer.alloc(padding), Buffer.from([i]), toBytes(toNumber(half, this.radix), this.b)
+        ]);
+
+        // PRF: CBC-MAC over P || Q, i.e. the last block of CBC encryption with a zero IV
+        const mac = createCipheriv(aesName(this.key, 'cbc'), this.key, Buffer.alloc(BLOCK));
+        mac.setAutoPadding(false);
+        const encrypted = Buffer.concat([mac.update(Buffer.concat([this.p, q])), mac.final()]);
+        const r = encrypted.subarray(encrypted.length - BLOCK);
+
+        // S = R || CIPH(R xor [1]) || CIPH(R xor [2]) || ..., truncated to d bytes
+        const blocks = [r];
+        for (let j = 1; j < Math.ceil(this.d / BLOCK); j++) {
+            const counter = toBytes(j, BLOCK);
+            const cipher = createCipheriv(aesName(this.key, 'ecb'), this.key, null);
+            cipher.setAutoPadding(false);
+            blocks.push(cipher.update(r.map((byte, k) => byte ^ counter[k])));
+        }
+        const s = Buffer.concat(blocks).subarray(0, this.d);
+        return BigInt(`0x${s.toString('hex')}`);
+    }
+
+    encrypt(numerals: number[]): number[] {
+        let a = numerals.slice(0, this.u);
+        let b = numerals.slice(this.u);
+        for (let i = 0; i < ROUNDS; i++) {
+            const m = i % 2 === 0 ? this.u : this.v;
+            const modulus = BigInt(this.radix) ** BigInt(m);
+            const c = (toNumber(a, this.radix) + this.round(i, b)) % modulus;
+            a = b;
+            b = toNumerals(c, this.radix, m);
+        }
+        return [...a, ...b];
+    }
+
+    decrypt(numerals: number[]): number[] {
+        let a = numerals.slice(0, this.u);
+        let b = numerals.slice(this.u);
+        for (let i = ROUNDS - 1; i >= 0; i--) {
+            const m = i % 2 === 0 ? this.u : this.v;
+            const modulus = BigInt(this.radix) ** BigInt(m);
+            const c = (((toNumber(b, this.radix) - this.round(i, a)) % modulus) + modulus) % modulus;
+            b = a;
+            a = toNumerals(c, this.radix, m);
+        }
+        return [...a, ...b];
+    }
+}
+
+export function ff1Encrypt(key: Uint8Array, radix: number, numerals: number[], tweak: Uint8Array = new Uint8Array(0)): number[] {
+    validate(key, radix, numerals);
+    return new FF1(key, radix, numerals.length, tweak).encrypt(numerals);
+}
+
+export function ff1Decrypt(key: Uint8Array, radix: number, numerals: number[], tweak: Uint8Array = new Uint8Array(0)): number[] {
+    validate(key, radix, numerals);
+    return new FF1(key, radix, numerals.length, tweak).decrypt(numerals);
+}
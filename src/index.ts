@@ -1,2 +1,16 @@
-export { SortableIDGenerator } from './sortable-id';
-export type { TimestampLevel, IDGeneratorConfig } from './sortable-id'; 
\ No newline at end of file
+export { SortableIDGenerator, MaxSortableRate, rateFromPerSecond, ratePerDuration, minimumTotalLength, minimumBase, machineIdWidth, verifyID, decodeAny, PID_SPACE, MonotonicChecker, decodeSelfDescribing } from './sortable-id';
+export type { TimestampLevel, IDGeneratorConfig, GeneratorState, SortableRate, DecodedID, GeneratedID, DecodedEvent, BufferPool } from './sortable-id';
+export {
+    AlphabetContext,
+    ALPHABET_DNS_SAFE,
+    ALPHABET_FILENAME_SAFE,
+    ALPHABET_URL_PATH_SAFE,
+    ALPHABET_CROCKFORD_BASE32,
+    ALPHABET_HEX,
+    ALPHABET_BASE62,
+    validateAlphabetForContext
+} from './alphabets';
+export { concat, splitConcat } from './composite';
+export { TypedGenerator } from './typed';
+export { LazyGenerator } from './lazy';
+export type { TypedID } from './typed';
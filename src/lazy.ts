@@ -0,0 +1,37 @@
+import { SortableIDGenerator } from './sortable-id';
+import type { IDGeneratorConfig, DecodedID } from './sortable-id';
+
+// Defers building a generator (validation and all the length math) until it is first used, for apps
+// that declare many configs but only use a few. Construction runs synchronously inside the first call,
+// so callers racing through async code still share one generator.
+export class LazyGenerator {
+    private generator: SortableIDGenerator | null = null;
+    private failure: { error: unknown } | null = null;
+
+    constructor(private readonly config: IDGeneratorConfig = {}) {}
+
+    public generate(): string {
+        return this.unwrap().generate();
+    }
+
+    public decode(id: string): DecodedID {
+        return this.unwrap().decode(id);
+    }
+
+    // The underlying generator, built on the first call. A bad config throws here, on first use rather
+    // than at declaration, and the same error is rethrown on every later call.
+    public unwrap(): SortableIDGenerator {
+        if (this.failure) {
+            throw this.failure.error;
+        }
+        if (this.generator === null) {
+            try {
+                this.generator = new SortableIDGenerator(this.config);
+            } catch (error) {
+                this.failure = { error };
+                throw error;
+            }
+        }
+        return this.generator;
+    }
+}
@@ -1,4 +1,8 @@
+import { timingSafeEqual } from 'crypto';
+import { performance } from 'perf_hooks';
 import { customAlphabet } from 'nanoid';
+import { ALPHABET_CROCKFORD_BASE32, assertDisjoint } from './alphabets';
+import { ff1Decrypt, ff1Encrypt, ff1MinLength, validateFF1Key } from './fpe';
 
 // Types for configuration
 export type TimestampLevel =  'millisecond' | 'second' | 
@@ -9,7 +13,42 @@ export enum MaxSortableRate {
     Micro1 = "1_per_microsecond",   // 1 generation per microsecond
     Milli10 = "10_per_millisecond",  // 10 generations per millisecond
     Second100 = "100_per_second",      // 100 generations per second
-    Second1 = "1_per_second"        // 1 generation per second
+    Second1 = "1_per_second",       // 1 generation per second
+    Minute1 = "1_per_minute",       // 1 generation per minute
+    Hour1 = "1_per_hour",           // 1 generation per hour
+    Day1 = "1_per_day"              // 1 generation per day
+}
+
+// A named rate, or an arbitrary number of generations per second
+export type SortableRate = MaxSortableRate | number;
+
+const NAMED_RATES_PER_SECOND: Record<MaxSortableRate, number> = {
+    [MaxSortableRate.Micro100]: 100 * 1000 * 1000,
+    [MaxSortableRate.Micro1]: 1 * 1000 * 1000,
+    [MaxSortableRate.Milli10]: 10 * 1000,
+    [MaxSortableRate.Second100]: 100,
+    [MaxSortableRate.Second1]: 1,
+    [MaxSortableRate.Minute1]: 1 / 60,
+    [MaxSortableRate.Hour1]: 1 / (60 * 60),
+    [MaxSortableRate.Day1]: 1 / (24 * 60 * 60)
+};
+
+// Returns the named rate for perSecond when one exists, otherwise perSecond itself
+export function rateFromPerSecond(perSecond: number): SortableRate {
+    if (!Number.isFinite(perSecond) || perSecond <= 0) {
+        throw new Error('Rate must be a positive number of generations per second');
+    }
+    const named = (Object.keys(NAMED_RATES_PER_SECOND) as MaxSortableRate[])
+        .find(rate => NAMED_RATES_PER_SECOND[rate] === perSecond);
+    return named ?? perSecond;
+}
+
+// Rate of count generations per durationMs milliseconds, e.g. ratePerDuration(2000, 250)
+export function ratePerDuration(count: number, durationMs: number): SortableRate {
+    if (!Number.isFinite(count) || count <= 0 || !Number.isFinite(durationMs) || durationMs <= 0) {
+        throw new Error('Rate count and duration must be positive numbers');
+    }
+    return rateFromPerSecond(count * 1000 / durationMs);
 }
 
 export interface IDGeneratorConfig {
@@ -17,117 +56,473 @@ export interface IDGeneratorConfig {
     totalLength?: number;
     timestampStart?: Date;
     timestampEnd?: Date;
+    defaultLifespan?: number;  // Range (in ms) used when timestampEnd is not set, instead of 200 years
     timestampLength?: number;
     timestampLevel?: TimestampLevel;
-    maxSortableRate?: MaxSortableRate;
+    maxSortableRate?: SortableRate;
+    // Caps the chrono length derived from maxSortableRate, leaving more room for the machine ID part
+    // (IDs generated past the capped capacity within one unit are ordered by the machine ID part instead)
+    maxChronoLength?: number;
+    clock?: () => Date;  // Source of the current time (defaults to the system clock)
+    // Called synchronously with each ID generate() (and the methods built on it) returns and the time it was
+    // generated for (as generateWithTime reports it), e.g. for audit logging. It should be quick; an error it
+    // throws reaches the caller.
+    onGenerate?: (id: string, generatedAt: Date) => void;
+    // Coarser level that decoded timestamps are rounded down to, so decoding doesn't reveal precise timing
+    decodeTruncateTo?: TimestampLevel;
+    trimOnDecode?: boolean;  // Strip surrounding whitespace (e.g. from IDs pasted out of logs) before decoding
+    // Inserts groupSeparator every groupEvery characters of generated IDs (e.g. xxxx-xxxx-xxxx) for readability;
+    // decoding strips it again. The separator must not be an alphabet character.
+    groupEvery?: number;
+    groupSeparator?: string;
+    // Replaces the built-in random machine ID part, e.g. with a deterministic tag
+    randomFunc?: (length: number, alphabet: string) => string;
+    minEntropyBits?: number;  // Minimum entropy of the machine ID part; off by default
+    // Makes the high half of the machine ID part a process-wide counter (low half stays random),
+    // which keeps IDs ordered after the chrono part overflows
+    counterInRandom?: boolean;
+    // Allows totalLength to leave no room for the machine ID part (IDs are then unique only within this generator)
+    allowZeroRandom?: boolean;
+    // Draws the machine ID part from the internal character pool and refills it at a random point
+    // (defense in depth against correlating refills with generation timing)
+    poolRefillJitter?: boolean;
+    // Caller-provided scratch buffers for drawing random bytes (generate(), sample(), randomMinPrefix,
+    // randomWeights, the poolRefillJitter pool), reused instead of allocated per call. Only the byte buffers:
+    // the ID strings are still built per call. Without one, the default random part comes from nanoid, which
+    // pools its own bytes.
+    bufferPool?: BufferPool;
+    // Characters never drawn for the machine ID part (e.g. visually confusable ones); still valid in IDs
+    randomCharExclude?: string;
+    // Never starts the machine ID part with alphabet[0], so IDs don't end in what looks like padding
+    randomMinPrefix?: boolean;
+    // Relative weights for drawing the first machine ID character, e.g. to route IDs to shards in proportion
+    // to their capacity. Characters without a weight are never drawn first; the rest stay uniform.
+    randomWeights?: Record<string, number>;
+    // Characters IDs must never start with (e.g. '-', which some collations and tools treat specially).
+    // The alphabet keeps its order; encoded timestamps are shifted up so their first character skips these.
+    avoidLeadingChars?: string;
+    // Centers the encoding on timestampStart so earlier times (as far back as timestampEnd is ahead) also sort correctly
+    signedEpoch?: boolean;
+    // Number of nodes to address: the machine ID part then starts with nodeId in machineIdWidth(clusterSize, base) symbols
+    clusterSize?: number;
+    nodeId?: number;  // This node's number, 0 to clusterSize-1 (required with clusterSize)
+    // Like clusterSize with the OS process ID (mod PID_SPACE) as nodeId, so processes on one host don't collide
+    embedPid?: boolean;
+    pid?: number;  // Process ID for embedPid (defaults to process.pid)
+    // After the chrono part overflows in several time units, switch to the next finer timestampLevel
+    // at the start of a new unit. Needs version: the promoted generator uses version + 1, so its IDs sort after older ones.
+    autoPromoteLevel?: boolean;
+    // Availability over accuracy: when a time unit runs out of IDs, move on to the next unit ahead of the clock
+    // instead of throwing (the timestamps of such IDs are slightly in the future; see generateWithFallback)
+    overflowFallback?: boolean;
+    // Called with the new effective config after an automatic promotion, so it can be persisted
+    onLevelPromoted?: (config: IDGeneratorConfig) => void;
+    // IDs containing any of these strings (e.g. reserved words) are never returned by generate()
+    blocklist?: string[];
+    blocklistFunc?: (id: string) => boolean;  // Like blocklist, for arbitrary rules
+    clockSkewTolerance?: number;  // Timestamps this many ms apart or less compare as equal in compareWithSkew
+    // Left-padding character for encoded numbers; must be the smallest alphabet character so padding sorts first
+    padChar?: string;
+    tagCapacity?: number;  // Max tags remembered by generateTagged (oldest are evicted first), default 1024
+    version?: number;  // Format version (0 to base-1) encoded as the first character; omitted when unset
+    // Starts IDs with alphabet[timestampLength], so decodeSelfDescribing() can read the timestamp knowing only
+    // the alphabet, epoch and level (not totalLength or timestampEnd). Can't be combined with version.
+    selfDescribing?: boolean;
+    // AES key (16, 24 or 32 bytes) for encrypt()/decodeEncrypted(), which map IDs to a same-length public
+    // form that hides the timestamp. Anyone holding the key can decrypt, so keep it out of source control.
+    encryptionKey?: Uint8Array;
+    // Starts each ID's chrono part at the fraction of its time unit already elapsed (falling back to counting
+    // up on ties), so IDs within one unit sort by when they were really made, to preciseClock's resolution
+    subUnitChrono?: boolean;
+    // Current time in ms since the Unix epoch, with a fractional part, for subUnitChrono. Defaults to the
+    // high-resolution performance clock, or to clock when one is given.
+    preciseClock?: () => number;
+}
+
+// Source of reusable scratch byte buffers, e.g. shared by several generators in a high-throughput service
+export interface BufferPool {
+    get(size: number): Uint8Array;  // A buffer of at least size bytes
+    put(buffer: Uint8Array): void;  // Returns a buffer from get() once the generator is done with it
+}
+
+export interface GeneratedID {
+    id: string;
+    timestamp: Date;
+    unixMillis: number;
+    chronoPart: string;
+    machineId: string;
+}
+
+export interface DecodedID {
+    version?: number;
+    timestamp: Date;
+    chronoPart: string;
+    machineId: string;
+    nodeId?: number;  // With clusterSize: the node that generated the ID
+    pid?: number;  // With embedPid: the process ID (mod PID_SPACE) that generated the ID
+    counterPart?: string;  // With counterInRandom: the counter half of machineId
+    entropyPart?: string;  // With counterInRandom: the random half of machineId
+    subUnitOffset?: number;  // With subUnitChrono: ms into the time unit the ID was generated at (per the chrono part)
+}
+
+// Commonly needed decoded facts, for audit pipelines
+export interface DecodedEvent {
+    timestamp: Date;
+    unixNanos: bigint;
+    sequenceInUnit: number;  // Chrono value, see rankInUnit
+    valid: boolean;  // False for IDs this generator can't decode (the other fields are then empty)
+}
+
+// Snapshot of the monotonic generation state, used to hand over to a standby generator
+export interface GeneratorState {
+    fingerprint: string;
+    lastTimeSpan: number;
+    lastChronoPart: string;
+    lastId: string;
+}
+
+// Process IDs embedPid tells apart (Linux pid_max is at most 2^22)
+export const PID_SPACE = 2 ** 22;
+
+// Human-readable suffix of generateDebug(): '#' and an ISO 8601 timestamp, which decoding strips
+const DEBUG_SUFFIX_MARK = '#';
+const DEBUG_SUFFIX = /#[+-]?\d{4,6}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{3}Z$/;
+
+// Prefix of the environment variables configEnv() and fromEnv() use
+const ENV_PREFIX = 'SORTABLE_NANOID_';
+
+// How many candidates generate() tries before giving up on finding an ID outside the blocklist
+const MAX_BLOCKLIST_ATTEMPTS = 100;
+
+// Largest per-unit ID space enumerateUnit will walk
+const MAX_ENUMERATE = 1_000_000;
+
+// Levels from coarsest to finest, for autoPromoteLevel
+const LEVELS_BY_PRECISION: TimestampLevel[] = ['year', 'month', 'day', 'hour', 'minute', 'second', 'millisecond'];
+
+// Number of time units with a chrono overflow after which autoPromoteLevel promotes
+const PROMOTE_AFTER_OVERFLOWS = 3;
+
+const LEVEL_TO_MS: Record<TimestampLevel, number> = {
+    millisecond: 1,
+    second: 1_000,
+    minute: 60_000,
+    hour: 3_600_000,
+    day: 86_400_000,
+    month: 2_592_000_000,
+    year: 31_536_000_000
+};
+
+// Levels counted in calendar months rather than fixed durations (LEVEL_TO_MS is only their approximate size)
+const CALENDAR_MONTHS: Partial<Record<TimestampLevel, number>> = {
+    month: 1,
+    year: 12
+};
+
+// Same UTC time of day, months later; the day is clamped to the end of shorter months (Jan 31 -> Feb 29).
+// UTC keeps the boundaries of units counted from a given date the same on every host (no DST shifts), but
+// they follow that date's UTC day and time: the default timestampStart, local midnight, moves them per time zone.
+function addCalendarMonths(date: Date, months: number): Date {
+    const total = date.getUTCMonth() + months;
+    const year = date.getUTCFullYear() + Math.floor(total / 12);
+    const month = ((total % 12) + 12) % 12;
+    const lastDay = new Date(date);
+    lastDay.setUTCFullYear(year, month + 1, 0);
+
+    const result = new Date(date);
+    result.setUTCFullYear(year, month, Math.min(date.getUTCDate(), lastDay.getUTCDate()));
+    return result;
+}
+
+// Fractional number of calendar units (unitMonths months each) from start to end
+function calendarSpan(start: Date, end: Date, unitMonths: number): number {
+    let months = (end.getUTCFullYear() - start.getUTCFullYear()) * 12 + end.getUTCMonth() - start.getUTCMonth();
+    if (addCalendarMonths(start, months) > end) {
+        months--;
+    }
+    const whole = Math.floor(months / unitMonths);
+    const unitStart = addCalendarMonths(start, whole * unitMonths).getTime();
+    const unitEnd = addCalendarMonths(start, (whole + 1) * unitMonths).getTime();
+    return whole + (end.getTime() - unitStart) / (unitEnd - unitStart);
+}
+
+function resolveIdsPerSecond(rate: SortableRate): number {
+    if (typeof rate === 'number') {
+        if (!Number.isFinite(rate) || rate <= 0) {
+            throw new Error('Max sortable rate must be a positive number of generations per second');
+        }
+        return rate;
+    }
+    return NAMED_RATES_PER_SECOND[rate] ?? NAMED_RATES_PER_SECOND[MaxSortableRate.Micro1]; // Default to Micro1
+}
+
+function calculateChronoLength(base: number, idsPerSecond: number, level: TimestampLevel): number {
+    // Adjust based on timestamp level (in ms, so sub-second units stay exact)
+    let unitMs: number;
+    switch (level) {
+        case 'year':
+            unitMs = 365 * 24 * 60 * 60 * 1000; // ms in a year
+            break;
+        case 'month':
+            unitMs = 31 * 24 * 60 * 60 * 1000; // ms in a month
+            break;
+        case 'day':
+            unitMs = 24 * 60 * 60 * 1000; // ms in a day
+            break;
+        case 'hour':
+            unitMs = 60 * 60 * 1000; // ms in an hour
+            break;
+        case 'minute':
+            unitMs = 60 * 1000; // ms in a minute
+            break;
+        case 'second':
+            unitMs = 1000; // ms in a second
+            break;
+        case 'millisecond':
+            unitMs = 1; // ms in a millisecond
+            break;
+        default:
+            unitMs = 1000; // default to second
+    }
+
+    // Calculate total IDs needed for this time unit
+    const totalIds = Math.ceil(idsPerSecond * unitMs / 1000);
+
+    // Calculate required length to represent totalIds in the given base
+    let length = 1;
+    let b = base;
+    //integer division (Math.floor rather than >> 0, which wraps above 2^31)
+    while (Math.floor(totalIds / b) > 0) {
+        length++;
+        b *= base;
+    }
+    return length;
+}
+
+function calculateTimestampLength(base: number, timespan: number): number {
+    // Smallest length whose capacity covers every unit in the range (at least one symbol, even for a
+    // single-unit range). Stepped in integers: log ratios overshoot exact powers, e.g. log(9) / log(3) > 2
+    const units = Math.ceil(timespan);
+    let length = 1;
+    for (let capacity = base; capacity < units; capacity *= base) {
+        length++;
+    }
+    return length;
+}
+
+// Smallest totalLength that covers lifespanMs at the given level and rate, with at least randomBits of entropy
+export function minimumTotalLength(alphabet: string, lifespanMs: number, level: TimestampLevel, rate: SortableRate, randomBits: number): number {
+    const base = new Set(alphabet).size;
+    if (base < 2) {
+        throw new Error('Alphabet must contain at least 2 unique characters');
+    }
+    validatePlanningInputs(lifespanMs, level, randomBits);
+    return layoutLength(base, lifespanMs, level, rate, randomBits);
+}
+
+// Smallest alphabet size (up to 256) that fits the same requirements into totalLength, for callers with a hard length limit
+export function minimumBase(totalLength: number, lifespanMs: number, level: TimestampLevel, rate: SortableRate, randomBits: number): number {
+    if (!Number.isInteger(totalLength) || totalLength < 1) {
+        throw new Error('Total length must be a positive integer');
+    }
+    validatePlanningInputs(lifespanMs, level, randomBits);
+    for (let base = 2; base <= 256; base++) {
+        if (layoutLength(base, lifespanMs, level, rate, randomBits) <= totalLength) {
+            return base;
+        }
+    }
+    throw new Error(`No alphabet of up to 256 characters fits these requirements into ${totalLength} characters`);
+}
+
+function validatePlanningInputs(lifespanMs: number, level: TimestampLevel, randomBits: number): void {
+    if (!Number.isFinite(lifespanMs) || lifespanMs < LEVEL_TO_MS[level]) {
+        throw new Error('Lifespan must cover at least one unit at the given level');
+    }
+    if (!Number.isFinite(randomBits) || randomBits < 0) {
+        throw new Error('Random bits must be a non-negative number');
+    }
+}
+
+function layoutLength(base: number, lifespanMs: number, level: TimestampLevel, rate: SortableRate, randomBits: number): number {
+    const timestampLength = calculateTimestampLength(base, lifespanMs / LEVEL_TO_MS[level]);
+    const chronoLength = calculateChronoLength(base, resolveIdsPerSecond(rate), level);
+    // At least one machine ID symbol, as the constructor requires
+    const machineIdLength = Math.max(1, Math.ceil(randomBits / Math.log2(base)));
+    return timestampLength + chronoLength + machineIdLength;
+}
+
+// Smallest all-ones bit mask covering every index of an alphabet of the given size
+function randomMask(alphabetLength: number): number {
+    return (2 << Math.floor(Math.log2(Math.max(1, alphabetLength - 1)))) - 1;
+}
+
+// Fewest symbols in the given base that give every one of clusterSize nodes a distinct ID
+export function machineIdWidth(clusterSize: number, base: number): number {
+    if (!Number.isInteger(clusterSize) || clusterSize < 1) {
+        throw new Error('Cluster size must be a positive integer');
+    }
+    if (!Number.isInteger(base) || base < 2) {
+        throw new Error('Base must be an integer of at least 2');
+    }
+
+    let width = 0;
+    for (let capacity = 1; capacity < clusterSize; capacity *= base) {
+        width++;
+    }
+    return width;
 }
 
+// FNV-1a (64-bit) hash of text
+function fnv1a64(text: string): bigint {
+    const FNV_PRIME = BigInt('0x100000001b3');
+    const MASK_64 = BigInt('0xffffffffffffffff');
+    let hash = BigInt('0xcbf29ce484222325');
+    for (let i = 0; i < text.length; i++) {
+        hash ^= BigInt(text.charCodeAt(i));
+        hash = (hash * FNV_PRIME) & MASK_64;
+    }
+    return hash;
+}
+
+// Shared by every counterInRandom generator in the process
+let processCounter = 0;
+
 export class SortableIDGenerator {
     private readonly DEFAULT_ALPHABET = '0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ-_';
-    private readonly LEVEL_TO_MS: Record<TimestampLevel, number> = {
-        millisecond: 1,
-        second: 1_000,
-        minute: 60_000,
-        hour: 3_600_000,
-        day: 86_400_000,
-        month: 2_592_000_000,
-        year: 31_536_000_000
-    };
+    private readonly LEVEL_TO_MS = LEVEL_TO_MS;
 
     private lastTimeSpan: number = 0;
     private lastId: string = '';
     private alphabet: string;
     private base: number;
+    private charIndex: Map<string, number>;  // Alphabet character -> index, for O(1) lookups
+    private codeIndex: Int16Array;  // Alphabet char code -> index (-1 for other codes), for decodeTimespanFast
+    private padChar: string;  // Left padding of encoded numbers (always alphabet[0])
     private totalLength: number;
     private timestampStart: Date;
-    private timestampLength: number;
+    private timestampEnd: Date;
+    private timestampLength!: number;  // Set by applyLayout, like the other level-dependent fields
     private chronoLength: number = 0;
-    private timestampLevel: TimestampLevel;
-    private maxTimestamp: number;
-    private maxSortableRate: MaxSortableRate;
+    private derivedChronoLength: number = 0;  // Chrono length maxSortableRate calls for, before maxChronoLength
+    private timestampLevel!: TimestampLevel;
+    private maxTimestamp!: number;
+    private signedOffset: number = 0;  // Encoded value of timestampStart with signedEpoch, 0 otherwise
+    private leadOffset: number = 0;  // Added to encoded timestamps so they don't start with avoidLeadingChars
+    private maxSortableRate: SortableRate;
+    private idsPerSecond!: number;
     private lastChronoPart: string = '';
     private readonly BUILTIN_TIMESTAMP_END_YEARS = 200;
     private readonly POOL_SIZE = 128;  // Size of the character pool
     private charPool: string[] = [];
     private poolOffset: number = 0;
-    private genRandomPart: () => string;
-    private readonly minChronoPart: string;  // Stores alphabet[0].repeat(chronoLength)
-    private readonly minMachineIdPart: string;  // Stores alphabet[0].repeat(machineIdLength)
-
-    private calculateChronoLength(base: number, rate: MaxSortableRate, level: TimestampLevel): number {
-        let idsPerSecond: number;
-
-        // First determine base IDs per unit from generation rate
-        switch (rate) {
-            case MaxSortableRate.Micro100:
-                idsPerSecond = 100 * 1000 * 1000;
-                break;
-            case MaxSortableRate.Micro1:
-                idsPerSecond = 1 * 1000 * 1000;
-                break;
-            case MaxSortableRate.Milli10:
-                idsPerSecond = 10 * 1000;
-                break;
-            case MaxSortableRate.Second100:
-                idsPerSecond = 100;
-                break;
-            case MaxSortableRate.Second1:
-                idsPerSecond = 1;
-                break;
-            default:
-                idsPerSecond = 1 * 1000 * 1000; // Default to Micro1
-        }
-
-        // Then adjust based on timestamp level
-        let multiplier: number;
-        switch (level) {
-            case 'year':
-                multiplier = 365 * 24 * 60 * 60; // seconds in a year
-                break;
-            case 'month':
-                multiplier = 31 * 24 * 60 * 60; // seconds in a month
-                break;
-            case 'day':
-                multiplier = 24 * 60 * 60; // seconds in a day
-                break;
-            case 'hour':
-                multiplier = 60 * 60; // seconds in an hour
-                break;
-            case 'minute':
-                multiplier = 60; // seconds in a minute
-                break;
-            case 'second':
-                multiplier = 1; // seconds in a second
-                break;
-            case 'millisecond':
-                multiplier = 0.001; // milliseconds in a second
-                break;
-            default:
-                multiplier = 1; // default to second
-        }
-
-        // Calculate total IDs needed for this time unit
-        const totalIds = Math.ceil(idsPerSecond * multiplier);
-
-        // Calculate required length to represent totalIds in the given base
-        let length = 1;
-        let b = base;
-        //integer division
-        while (((totalIds / b) >> 0) > 0) {
-            length++;
-            b *= base;
-        }
-        return length;
-    }
+    private poolLimit: number = 0;  // Offset at which the pool is refilled (randomized with poolRefillJitter)
+    private poolRefillJitter: boolean = false;
+    private bufferPool: BufferPool | null;
+    private randomAlphabet: string;  // Alphabet minus randomCharExclude, used for fresh random characters
+    private firstRandomAlphabet: string | null = null;  // With randomMinPrefix: randomAlphabet minus alphabet[0]
+    private firstRandomWeights: { chars: string, cumulative: number[] } | null = null;  // With randomWeights
+    private genRandomPart!: () => string;
+    private machineIdLength!: number;
+    private counterLength: number = 0;  // Leading machine ID symbols used as a counter (counterInRandom)
+    private nodePrefix: string = '';  // With clusterSize: nodeId encoded at the start of the machine ID part
+    private embedsPid: boolean = false;  // nodePrefix holds the process ID (embedPid)
+    private version: number | undefined;
+    private versionPrefix: string = '';  // alphabet[version] when a version is configured
+    // Random parts peek() drew (for a new timestamp or a blocklist reroll), in order, for the next generate()
+    private pendingRandomParts: string[] = [];
+    private pendingPromotedRandomParts: string[] = [];  // Likewise, for the first ID after a due promotion
+    private peekCursor: number | null = null;  // While peek() runs: the next pendingRandomParts entry to use
+    private clock: () => Date;
+    private preciseClock: (() => number) | null = null;  // With subUnitChrono
+    private onGenerate: ((id: string, generatedAt: Date) => void) | null;
+    private decodeTruncateTo!: TimestampLevel;
+    private trimOnDecode: boolean;
+    private groupEvery: number = 0;
+    private groupSeparator: string = '';
+    private tags: Map<string, string> = new Map();  // ID -> tag, in insertion order for eviction
+    private tagCapacity: number;
+    private clockSkewTolerance: number;
+    private isBlocked: ((id: string) => boolean) | null = null;
+    private overflowFallback: boolean;
+    private usedFallback: boolean = false;  // Whether the last generated ID came from overflowFallback
+    // Whether to stay in the last unit until the clock reaches it (after overflowFallback moved ahead, or importState)
+    private holdUnitAhead: boolean = false;
+    private encryptionKey: Uint8Array | null = null;
+    private overflowedUnits: number = 0;  // Time units in which the chrono part overflowed (autoPromoteLevel)
+    private lastOverflowTimespan: number | null = null;
+    // Bounds (in ms) of the time unit the last computed timespan belongs to
+    private unitStartMs: number = 0;
+    private unitEndMs: number = 0;
+    private unitTimespan: number = 0;
+    private readonly options: IDGeneratorConfig;  // Config as given (updated by promoteLevel), for config()
+    private minChronoPart!: string;  // Stores alphabet[0].repeat(chronoLength)
+    private minMachineIdPart!: string;  // Stores alphabet[0].repeat(machineIdLength)
 
     constructor(config: IDGeneratorConfig = {}) {
+        this.options = { ...config };
+
         // Set defaults and validate configuration
         this.alphabet = (config.alphabet || this.DEFAULT_ALPHABET).split('').sort().join('');
         this.base = this.alphabet.length;
+        this.charIndex = new Map([...this.alphabet].map((char, i) => [char, i]));
+        this.codeIndex = new Int16Array(Math.max(...[...this.alphabet].map(char => char.charCodeAt(0))) + 1).fill(-1);
+        [...this.alphabet].forEach((char, i) => { this.codeIndex[char.charCodeAt(0)] = i; });
         this.totalLength = config.totalLength || 32;
-        this.timestampStart = config.timestampStart || new Date(2024, 0, 1);
-        this.timestampLevel = config.timestampLevel || 'millisecond';
-        this.maxSortableRate = config.maxSortableRate || MaxSortableRate.Micro1;
+        this.timestampStart = config.timestampStart || new Date(2024, 0, 1);  // Also the default in readingGenerator
+        this.maxSortableRate = config.maxSortableRate ?? MaxSortableRate.Micro1;
+        this.clock = config.clock || (() => new Date());
+        this.trimOnDecode = config.trimOnDecode || false;
+        this.bufferPool = config.bufferPool ?? null;
+        this.onGenerate = config.onGenerate ?? null;
+        this.overflowFallback = config.overflowFallback || false;
+        if (config.subUnitChrono) {
+            const clock = this.clock;
+            this.preciseClock = config.preciseClock
+                ?? (config.clock ? () => clock().getTime() : () => performance.timeOrigin + performance.now());
+        }
+        if (config.encryptionKey !== undefined) {
+            validateFF1Key(config.encryptionKey);
+            if (this.totalLength < ff1MinLength(this.base)) {
+                throw new Error(`Encryption needs a total length of at least ${ff1MinLength(this.base)} in base ${this.base}`);
+            }
+            // Copied so later changes to the caller's buffer don't change the key
+            this.encryptionKey = Uint8Array.from(config.encryptionKey);
+        }
+        if (config.groupEvery !== undefined || config.groupSeparator !== undefined) {
+            if (!Number.isInteger(config.groupEvery) || (config.groupEvery as number) < 1) {
+                throw new Error('groupEvery must be a positive integer');
+            }
+            if (typeof config.groupSeparator !== 'string' || [...config.groupSeparator].length !== 1) {
+                throw new Error('groupSeparator must be a single character');
+            }
+            assertDisjoint(this.alphabet, config.groupSeparator, 'groupSeparator');
+            this.groupEvery = config.groupEvery as number;
+            this.groupSeparator = config.groupSeparator;
+        }
+        this.clockSkewTolerance = config.clockSkewTolerance ?? 0;
+        if (!Number.isFinite(this.clockSkewTolerance) || this.clockSkewTolerance < 0) {
+            throw new Error('clockSkewTolerance must be a non-negative number of milliseconds');
+        }
+        if (config.randomWeights) {
+            // Copied so later changes to the caller's object don't change a promoted layout or configEnv()
+            this.options.randomWeights = { ...config.randomWeights };
+        }
+        if (config.blocklist) {
+            // Copied so later changes to the caller's array don't bypass validation or change generation
+            this.options.blocklist = [...config.blocklist];
+        }
+        if (config.blocklist || config.blocklistFunc) {
+            const blocklist = this.options.blocklist || [];
+            if (blocklist.some(entry => typeof entry !== 'string' || entry === '')) {
+                throw new Error('Blocklist entries must be non-empty strings');
+            }
+            const blocklistFunc = config.blocklistFunc;
+            this.isBlocked = id => blocklist.some(entry => id.includes(entry)) || (blocklistFunc ? blocklistFunc(id) : false);
+        }
+        this.tagCapacity = config.tagCapacity ?? 1024;
+        if (!Number.isInteger(this.tagCapacity) || this.tagCapacity < 1) {
+            throw new Error('Tag capacity must be a positive integer');
+        }
 
         // Validate alphabet
         if (this.alphabet.length < 2) {
@@ -137,63 +532,382 @@ export class SortableIDGenerator {
             throw new Error('Alphabet must contain unique characters');
         }
 
-        // Calculate timestamp length based on built-in end date (200 years from start)
-        const endDate = new Date(this.timestampStart);
-        endDate.setFullYear(endDate.getFullYear() + this.BUILTIN_TIMESTAMP_END_YEARS);
-        const timespan = this.getTimespan(endDate);
-        this.timestampLength = this.calculateRequiredLength(timespan);
+        this.padChar = config.padChar ?? this.alphabet[0];
+        if (this.padChar !== this.alphabet[0]) {
+            throw new Error(`padChar '${this.padChar}' must be the smallest alphabet character ('${this.alphabet[0]}') to preserve sort order`);
+        }
+
+        this.randomAlphabet = [...this.alphabet].filter(char => !(config.randomCharExclude || '').includes(char)).join('');
+        if (this.randomAlphabet.length < 2) {
+            throw new Error('Alphabet must keep at least 2 characters after randomCharExclude');
+        }
+        // Random characters are drawn one byte at a time, so a mask wider than a byte would leave
+        // the characters past index 255 unreachable
+        if (this.randomAlphabet.length > 256) {
+            throw new Error(`Random alphabet has ${this.randomAlphabet.length} characters, more than the 256 a random byte can select from`);
+        }
+
+        if (config.version !== undefined) {
+            if (!Number.isInteger(config.version) || config.version < 0 || config.version >= this.base) {
+                throw new Error(`Version must be an integer between 0 and ${this.base - 1}`);
+            }
+            this.version = config.version;
+            this.versionPrefix = this.alphabet[config.version];
+        }
+        if (config.autoPromoteLevel && this.version === undefined) {
+            throw new Error('autoPromoteLevel requires a version, so promoted IDs can sort after earlier ones');
+        }
+
+        // Calculate timestamp length based on timestampEnd, or the default lifespan (200 years from start unless set)
+        let endDate = config.timestampEnd;
+        if (!endDate && config.defaultLifespan !== undefined) {
+            if (!Number.isFinite(config.defaultLifespan) || config.defaultLifespan <= 0) {
+                throw new Error('defaultLifespan must be a positive number of milliseconds');
+            }
+            endDate = new Date(this.timestampStart.getTime() + config.defaultLifespan);
+        }
+        if (!endDate) {
+            endDate = new Date(this.timestampStart);
+            endDate.setFullYear(endDate.getFullYear() + this.BUILTIN_TIMESTAMP_END_YEARS);
+        }
+        this.timestampEnd = endDate;
+
+        this.applyLayout(config.timestampLevel || 'millisecond');
+        this.lastChronoPart = this.minChronoPart;
+        this.assertBlocklistFeasible();
+    }
+
+    // Rejects blocklist entries that every ID would match, because they are part of the version and the
+    // (padded) timestamp the current time encodes to, e.g. '-' with the default alphabet, whose timestamps
+    // start with that padding for decades. blocklistFunc can't be checked ahead of time.
+    private assertBlocklistFeasible(): void {
+        const blocklist = this.options.blocklist || [];
+        if (blocklist.length === 0) {
+            return;
+        }
+        const timespan = Math.floor(this.getTimespan(this.clock(), true));
+        const prefix = timespan >= -this.signedOffset && timespan < this.maxTimestamp
+            ? this.versionPrefix + this.encodeTimestamp(timespan)
+            : this.versionPrefix;
+        const hopeless = blocklist.find(entry => prefix.includes(entry));
+        if (hopeless !== undefined) {
+            throw new Error(`Blocklist entry '${hopeless}' matches every ID generated now, so generation would always fail`);
+        }
+    }
+
+    // Derives everything that depends on the timestamp level (part lengths, the random part generator and
+    // the minimal parts) from the options and the version. Used by the constructor and by promoteLevel.
+    private applyLayout(level: TimestampLevel): void {
+        const config = this.options;
+        this.timestampLevel = level;
+        this.decodeTruncateTo = config.decodeTruncateTo || level;
+        if (this.LEVEL_TO_MS[this.decodeTruncateTo] < this.LEVEL_TO_MS[this.timestampLevel]) {
+            throw new Error('decodeTruncateTo must not be finer than timestampLevel');
+        }
+        this.signedOffset = 0;
+        this.leadOffset = 0;
+        this.nodePrefix = '';
+        this.embedsPid = false;
+        this.counterLength = 0;
+        this.firstRandomAlphabet = null;
+        this.firstRandomWeights = null;
+        // Forget the cached unit bounds, which were computed at the previous level
+        this.unitStartMs = 0;
+        this.unitEndMs = 0;
+        this.unitTimespan = 0;
+
+        const timespan = this.getTimespan(this.timestampEnd);
+        if (timespan < 1) {
+            throw new Error(`Timestamp range must span at least one unit at the configured level (${this.timestampLevel})`);
+        }
         this.maxTimestamp = timespan;
+        if (config.signedEpoch) {
+            // Encode offsets from the middle of a doubled range, so times before timestampStart
+            // (down to the same distance as timestampEnd after it) still sort correctly
+            this.signedOffset = Math.ceil(timespan);
+            this.timestampLength = this.calculateRequiredLength(2 * this.signedOffset);
+        } else {
+            this.timestampLength = this.calculateRequiredLength(timespan);
+        }
+        if (config.selfDescribing) {
+            if (this.version !== undefined || config.signedEpoch || config.avoidLeadingChars) {
+                throw new Error('selfDescribing cannot be combined with version, signedEpoch or avoidLeadingChars');
+            }
+            if (this.timestampLength >= this.base) {
+                throw new Error(`Timestamp length ${this.timestampLength} cannot be described by a single character in base ${this.base}`);
+            }
+            this.versionPrefix = this.alphabet[this.timestampLength];
+        }
+        if (config.avoidLeadingChars) {
+            this.avoidLeadingChars(config.avoidLeadingChars, config.signedEpoch ? 2 * this.signedOffset : Math.ceil(timespan));
+        }
 
         // Calculate chrono length based on maxSortableRate
-        this.chronoLength = this.calculateChronoLength(this.base, this.maxSortableRate, this.timestampLevel);
+        this.idsPerSecond = resolveIdsPerSecond(this.maxSortableRate);
+        this.derivedChronoLength = calculateChronoLength(this.base, this.idsPerSecond, this.timestampLevel);
+        this.chronoLength = this.derivedChronoLength;
+        if (config.maxChronoLength !== undefined) {
+            if (!Number.isInteger(config.maxChronoLength) || config.maxChronoLength < 1) {
+                throw new Error('maxChronoLength must be a positive integer');
+            }
+            this.chronoLength = Math.min(this.chronoLength, config.maxChronoLength);
+        }
 
         // Validate total length
-        const minRequiredLength = this.timestampLength + this.chronoLength + 1; // +1 for machine ID part
+        const versionLength = this.versionPrefix.length;
+        const minMachineIdLength = config.allowZeroRandom ? 0 : 1;
+        const minRequiredLength = versionLength + this.timestampLength + this.chronoLength + minMachineIdLength;
+        if (this.totalLength < minRequiredLength && versionLength + this.timestampLength + 1 + minMachineIdLength <= this.totalLength) {
+            // The timestamp fits on its own, so it is the chrono part that doesn't
+            throw new Error(`Max sortable rate ${this.formatRate()} needs ${this.chronoLength} chrono symbols in base ${this.base}, ` +
+                `leaving no room within total length ${this.totalLength}; use a larger alphabet or a lower maxSortableRate`);
+        }
         if (this.totalLength < minRequiredLength) {
-            throw new Error(`Total length must be at least ${minRequiredLength} (${this.timestampLength} for timestamp + ${this.chronoLength} for chrono + 1 for machine ID)`);
+            throw new Error(`Total length must be at least ${minRequiredLength} (${versionLength ? '1 for version + ' : ''}${this.timestampLength} for timestamp + ${this.chronoLength} for chrono + ${minMachineIdLength} for machine ID)`);
         }
 
-        if (this.getMaxDate() < new Date()) {
+        if (this.getMaxDate() < this.clock()) {
             throw new Error('Max date is in the past, you may need to increase the timestamp length');
         }
 
         // Create the random generator for machine ID part
-        const machineIdLength = this.totalLength - this.timestampLength - this.chronoLength;
-        this.genRandomPart = customAlphabet(this.alphabet, machineIdLength);
+        const machineIdLength = this.totalLength - versionLength - this.timestampLength - this.chronoLength;
+        this.machineIdLength = machineIdLength;
+
+        let clusterSize = config.clusterSize;
+        let nodeId = config.nodeId;
+        if (config.embedPid) {
+            if (clusterSize !== undefined) {
+                throw new Error('embedPid cannot be combined with clusterSize');
+            }
+            const pid = config.pid ?? process.pid;
+            if (!Number.isInteger(pid) || pid < 0) {
+                throw new Error('Process ID must be a non-negative integer');
+            }
+            clusterSize = PID_SPACE;
+            nodeId = pid % PID_SPACE;
+            this.embedsPid = true;
+        }
+        if (clusterSize !== undefined) {
+            const name = config.embedPid ? 'embedPid' : `Cluster size ${clusterSize}`;
+            const width = machineIdWidth(clusterSize, this.base);
+            if (width > machineIdLength - minMachineIdLength) {
+                throw new Error(`${name} needs ${width} machine ID symbols in base ${this.base}, ` +
+                    `but only ${machineIdLength - minMachineIdLength} are available within total length ${this.totalLength}`);
+            }
+            if (nodeId === undefined || !Number.isInteger(nodeId) || nodeId < 0 || nodeId >= clusterSize) {
+                throw new Error(`Node ID must be an integer between 0 and ${clusterSize - 1}`);
+            }
+            if (config.counterInRandom || config.randomMinPrefix) {
+                throw new Error(`${config.embedPid ? 'embedPid' : 'clusterSize'} cannot be combined with counterInRandom or randomMinPrefix`);
+            }
+            this.nodePrefix = width > 0 ? this.encodeNumber(nodeId, width) : '';
+        }
+
+        const randomLength = machineIdLength - this.nodePrefix.length;
+        const entropyBits = randomLength * Math.log2(this.base);
+        if (config.minEntropyBits !== undefined && entropyBits < config.minEntropyBits) {
+            throw new Error(`Machine ID part has ${entropyBits.toFixed(1)} bits of entropy (${randomLength} symbols in base ${this.base}), ` +
+                `below minEntropyBits ${config.minEntropyBits}; increase totalLength or use a larger alphabet`);
+        }
+
+        if (config.counterInRandom) {
+            if (machineIdLength < 2) {
+                throw new Error('counterInRandom needs a machine ID part of at least 2 symbols');
+            }
+            this.counterLength = Math.floor(machineIdLength / 2);
+        }
+
+        if (config.randomMinPrefix && machineIdLength > 0) {
+            if (this.counterLength > 0) {
+                throw new Error('randomMinPrefix cannot be combined with counterInRandom');
+            }
+            this.firstRandomAlphabet = this.randomAlphabet.replace(this.alphabet[0], '');
+        }
+
+        if (config.randomWeights !== undefined) {
+            if (machineIdLength === 0 || this.counterLength > 0 || this.firstRandomAlphabet || this.nodePrefix) {
+                throw new Error('randomWeights needs a machine ID part and cannot be combined with counterInRandom, randomMinPrefix, clusterSize or embedPid');
+            }
+            let chars = '';
+            const cumulative: number[] = [];
+            let total = 0;
+            for (const [char, weight] of Object.entries(config.randomWeights)) {
+                if (char.length !== 1 || !this.randomAlphabet.includes(char)) {
+                    throw new Error(`randomWeights key '${char}' is not a character of the random alphabet`);
+                }
+                if (!Number.isInteger(weight) || weight < 0) {
+                    throw new Error(`randomWeights weight for '${char}' must be a non-negative integer`);
+                }
+                if (weight > 0) {
+                    total += weight;
+                    chars += char;
+                    cumulative.push(total);
+                }
+            }
+            if (total === 0 || total > 2 ** 32) {
+                throw new Error('randomWeights must add up to between 1 and 2^32');
+            }
+            this.firstRandomWeights = { chars, cumulative };
+        }
+
+        const randomFunc = config.randomFunc;
+        const entropyLength = randomLength - this.counterLength - (this.firstRandomAlphabet || this.firstRandomWeights ? 1 : 0);
+        this.poolRefillJitter = config.poolRefillJitter || false;
+        const genEntropy = entropyLength === 0
+            ? () => ''
+            : this.poolRefillJitter && !randomFunc
+            ? () => Array.from({ length: entropyLength }, () => this.getRandomChar()).join('')
+            : randomFunc
+            ? () => this.validateRandomPart(randomFunc(entropyLength, this.randomAlphabet), entropyLength)
+            : this.bufferPool
+            ? () => this.randomString(entropyLength, bytes => { crypto.getRandomValues(bytes); })
+            : customAlphabet(this.randomAlphabet, entropyLength);
+        const firstRandomAlphabet = this.firstRandomAlphabet;
+        const nodePrefix = this.nodePrefix;
+        this.genRandomPart = nodePrefix
+            ? () => nodePrefix + genEntropy()
+            : this.counterLength > 0
+            ? () => this.encodeNumber(processCounter++ % Math.pow(this.base, this.counterLength), this.counterLength) + genEntropy()
+            : firstRandomAlphabet
+            ? () => this.randomString(1, bytes => { crypto.getRandomValues(bytes); }, firstRandomAlphabet) + genEntropy()
+            : this.firstRandomWeights
+            ? () => this.weightedChar(bytes => { crypto.getRandomValues(bytes); }) + genEntropy()
+            : genEntropy;
 
         // Initialize repeated strings
         this.minChronoPart = this.alphabet[0].repeat(this.chronoLength);
         this.minMachineIdPart = this.alphabet[0].repeat(machineIdLength);
-        this.lastChronoPart = this.minChronoPart;
     }
 
-    private getTimespan(endDate: Date): number {
-        const startMs = this.timestampStart.getTime();
-        const endMs = endDate.getTime();
-        const timespan = (endMs - startMs) / this.LEVEL_TO_MS[this.timestampLevel];
+    // ULID-style layout: Crockford Base32, 26 characters, millisecond timestamps
+    public static ulidLike(): SortableIDGenerator {
+        return new SortableIDGenerator({
+            alphabet: ALPHABET_CROCKFORD_BASE32,
+            totalLength: 26,
+            timestampLevel: 'millisecond'
+        });
+    }
+
+    // Decimal-only IDs of exactly lengthDigits digits, for legacy systems that need numeric sortable keys
+    public static numeric(lengthDigits: number, timestampStart?: Date, timestampLevel?: TimestampLevel,
+        maxSortableRate?: SortableRate): SortableIDGenerator {
+        if (!Number.isInteger(lengthDigits) || lengthDigits < 1) {
+            throw new Error('Numeric ID length must be a positive integer');
+        }
+        return new SortableIDGenerator({
+            alphabet: '0123456789',
+            totalLength: lengthDigits,
+            timestampStart,
+            timestampLevel,
+            maxSortableRate
+        });
+    }
+
+    // Re-encodes an ID of `from` in the layout of `to` (e.g. to migrate to another alphabet), keeping its
+    // timestamp and the numeric values of its chrono and machine ID parts, so relative order is preserved
+    public static transcodeID(from: SortableIDGenerator, to: SortableIDGenerator, id: string): string {
+        if (from.timestampLevel !== to.timestampLevel || from.timestampStart.getTime() !== to.timestampStart.getTime()) {
+            throw new Error('Generators must share timestampLevel and timestampStart to transcode IDs');
+        }
+        const { timestampPart, chronoPart, machineIdPart } = from.splitId(from.checkedId(id));
+
+        const timespan = from.decodeTimespan(timestampPart);
+        if (timespan >= to.maxTimestamp || timespan < -to.signedOffset) {
+            throw new Error('ID timestamp is outside the range of the target generator');
+        }
+        const reencode = (part: string, length: number, name: string): string => {
+            let value = BigInt(0);
+            for (const char of part) {
+                value = value * BigInt(from.base) + BigInt(from.indexOf(char));
+            }
+            let result = '';
+            for (let i = 0; i < length; i++) {
+                result = to.alphabet[Number(value % BigInt(to.base))] + result;
+                value /= BigInt(to.base);
+            }
+            if (value > BigInt(0)) {
+                throw new Error(`ID ${name} part does not fit in the target generator's ${length} symbols`);
+            }
+            return result;
+        };
+
+        return to.group(to.versionPrefix + to.encodeTimestamp(timespan) +
+            reencode(chronoPart, to.chronoLength, 'chrono') + reencode(machineIdPart, to.machineIdLength, 'machine ID'));
+    }
+
+    private getTimespan(endDate: Date, allowNegative: boolean = false): number {
+        const timespan = this.spanAtLevel(endDate, this.timestampLevel);
         
-        if (timespan < 0) {
+        if (timespan < 0 && !allowNegative) {
             throw new Error('End date cannot be before start date');
         }
         
         return timespan;
     }
 
+    // Fractional number of level units from timestampStart to date
+    private spanAtLevel(date: Date, level: TimestampLevel): number {
+        const unitMonths = CALENDAR_MONTHS[level];
+        return unitMonths
+            ? calendarSpan(this.timestampStart, date, unitMonths)
+            : (date.getTime() - this.timestampStart.getTime()) / this.LEVEL_TO_MS[level];
+    }
+
+    private getCurrentTimespan(now: Date = this.clock()): number {
+        const nowMs = now.getTime();
+
+        // Fast path: still inside the unit computed last time
+        if (nowMs >= this.unitStartMs && nowMs < this.unitEndMs) {
+            return this.unitTimespan;
+        }
+
+        const timespan = Math.floor(this.getTimespan(now, this.signedOffset > 0));
+        this.unitTimespan = timespan;
+        this.unitStartMs = this.timespanToMs(timespan);
+        this.unitEndMs = this.timespanToMs(timespan + 1);
+        return timespan;
+    }
+
+    // Inverse of getTimespan: the time (in ms) a possibly fractional timespan from the epoch corresponds to
+    private timespanToMs(timespan: number, epoch: Date = this.timestampStart): number {
+        const unitMonths = CALENDAR_MONTHS[this.timestampLevel];
+        if (!unitMonths) {
+            return epoch.getTime() + timespan * this.LEVEL_TO_MS[this.timestampLevel];
+        }
+        const whole = Math.floor(timespan);
+        const unitStart = addCalendarMonths(epoch, whole * unitMonths).getTime();
+        if (whole === timespan) {
+            return unitStart;
+        }
+        const unitEnd = addCalendarMonths(epoch, (whole + 1) * unitMonths).getTime();
+        return unitStart + (timespan - whole) * (unitEnd - unitStart);
+    }
+
     private calculateMaxTimestamp(length: number): number {
         return Math.pow(this.base, length);
     }
 
     private calculateRequiredLength(timespan: number): number {
-        return Math.ceil(Math.log(timespan) / Math.log(this.base));
+        return calculateTimestampLength(this.base, timespan);
     }
 
     private encodeTimestamp(timestamp: number): string {
+        return this.encodeNumber(timestamp + this.signedOffset + this.leadOffset, this.timestampLength);
+    }
+
+    // Index of char in the alphabet, or -1 when it isn't part of it
+    private indexOf(char: string): number {
+        return this.charIndex.get(char) ?? -1;
+    }
+
+    private encodeNumber(value: number, length: number): string {
         let result = '';
-        let remaining = Math.floor(timestamp);
+        let remaining = Math.floor(value);
 
         // Handle zero case
         if (remaining === 0) {
-            return this.alphabet[0].repeat(this.timestampLength);
+            return this.padChar.repeat(length);
         }
 
         while (remaining > 0) {
@@ -201,170 +915,1827 @@ export class SortableIDGenerator {
             remaining = Math.floor(remaining / this.base);
         }
 
-        return result.padStart(this.timestampLength, this.alphabet[0]);
+        return result.padStart(length, this.padChar);
     }
 
     private fillCharPool(): void {
-        // Create a new pool of random characters
-        const bytes = new Uint8Array(this.POOL_SIZE);
-        crypto.getRandomValues(bytes);
-        
-        this.charPool = Array.from({ length: this.POOL_SIZE }, (_, i) => {
-            // Use modulo to map random bytes to alphabet indices, excluding the last char
-            return this.alphabet[bytes[i] % (this.alphabet.length - 1)];
-        });
+        // Create a new pool of random characters, uniform over the random alphabet
+        const fillRandom = (bytes: Uint8Array) => { crypto.getRandomValues(bytes); };
+        this.charPool = this.randomString(this.POOL_SIZE, fillRandom).split('');
         this.poolOffset = 0;
+
+        // With jitter, refill after a random number of characters between half and all of the pool,
+        // so refills can't be correlated with generation timing. Unused characters are discarded.
+        const half = this.POOL_SIZE / 2;
+        this.poolLimit = this.poolRefillJitter
+            ? this.withScratch(1, bytes => {
+                fillRandom(bytes);
+                return half + bytes[0] % (half + 1);
+            })
+            : this.POOL_SIZE;
     }
 
     private getRandomChar(): string {
-        if (this.poolOffset >= this.charPool.length) {
+        if (this.poolOffset >= this.poolLimit) {
             this.fillCharPool();
         }
         return this.charPool[this.poolOffset++];
     }
 
-    private incrementStringPart(value: string): string {
+    private randomString(length: number, fillRandom: (bytes: Uint8Array) => void, alphabet: string = this.randomAlphabet): string {
+        // Rejection sampling against the smallest covering bit mask keeps every character equally likely
+        const mask = randomMask(alphabet.length);
+        return this.withScratch(Math.max(1, length * 2), bytes => {
+            let result = '';
+            while (result.length < length) {
+                fillRandom(bytes);
+                for (let i = 0; i < bytes.length && result.length < length; i++) {
+                    const index = bytes[i] & mask;
+                    if (index < alphabet.length) {
+                        result += alphabet[index];
+                    }
+                }
+            }
+            return result;
+        });
+    }
+
+    // Runs use with size scratch bytes, from the buffer pool when there is one
+    private withScratch<T>(size: number, use: (bytes: Uint8Array) => T): T {
+        const buffer = this.bufferPool ? this.bufferPool.get(size) : new Uint8Array(size);
+        if (buffer.length < size) {
+            throw new Error(`Buffer pool returned ${buffer.length} bytes, fewer than the ${size} requested`);
+        }
+        try {
+            return use(buffer.length === size ? buffer : buffer.subarray(0, size));
+        } finally {
+            this.bufferPool?.put(buffer);
+        }
+    }
+
+    // A character drawn with the probabilities given by randomWeights
+    private weightedChar(fillRandom: (bytes: Uint8Array) => void): string {
+        const { chars, cumulative } = this.firstRandomWeights as { chars: string, cumulative: number[] };
+        const total = cumulative[cumulative.length - 1];
+        // Rejection sampling over 32 random bits keeps the draw unbiased for any total
+        const limit = Math.floor(2 ** 32 / total) * total;
+        const value = this.withScratch(4, bytes => {
+            let drawn: number;
+            do {
+                fillRandom(bytes);
+                drawn = ((bytes[0] << 24) >>> 0) + (bytes[1] << 16) + (bytes[2] << 8) + bytes[3];
+            } while (drawn >= limit);
+            return drawn % total;
+        });
+
+        let index = 0;
+        while (cumulative[index] <= value) {
+            index++;
+        }
+        return chars[index];
+    }
+
+    private describeLengthMismatch(id: string): string {
+        const message = `ID must be exactly ${this.totalLength} characters long`;
+        if (!id || id.length <= this.totalLength) {
+            return message;
+        }
+        if (id.trim() !== id) {
+            return `${message} (it has leading or trailing whitespace)`;
+        }
+
+        // Point out extra characters around an otherwise valid-looking ID, e.g. an unexpected prefix
+        const isValid = (value: string) => [...value].every(char => this.indexOf(char) >= 0);
+        const extra = id.length - this.totalLength;
+        if (isValid(id.slice(extra))) {
+            return `${message} (it has ${extra} unexpected leading characters '${id.slice(0, extra)}')`;
+        }
+        if (isValid(id.slice(0, this.totalLength))) {
+            return `${message} (it has ${extra} unexpected trailing characters '${id.slice(this.totalLength)}')`;
+        }
+        return message;
+    }
+
+    // Position-weighted sum, so most typos and transpositions change the result
+    private checksumChar(value: string): string {
+        let sum = 0;
+        for (let i = 0; i < value.length; i++) {
+            sum = (sum + (i + 1) * (this.indexOf(value[i]) + 1)) % this.base;
+        }
+        return this.alphabet[sum];
+    }
+
+    private decodeTimespan(timestampPart: string): number {
+        let timestamp = 0;
+        for (let i = 0; i < timestampPart.length; i++) {
+            timestamp = timestamp * this.base + this.indexOf(timestampPart[i]);
+        }
+        return timestamp - this.signedOffset - this.leadOffset;
+    }
+
+    // Picks leadOffset (lengthening the timestamp if needed) so that every encoded timestamp up to maxEncoded
+    // starts with a character outside avoid
+    private avoidLeadingChars(avoid: string, maxEncoded: number): void {
+        if ([...avoid].some(char => this.indexOf(char) < 0)) {
+            throw new Error('avoidLeadingChars must only contain alphabet characters');
+        }
+        if (this.versionPrefix && avoid.includes(this.versionPrefix)) {
+            throw new Error(`Version character '${this.versionPrefix}' is in avoidLeadingChars`);
+        }
+        if (![...this.alphabet].some(char => !avoid.includes(char))) {
+            throw new Error('avoidLeadingChars must leave at least one alphabet character');
+        }
+        const { length, offset } = this.leadShift(avoid, this.timestampLength, maxEncoded);
+        this.timestampLength = length;
+        this.leadOffset = offset;
+    }
+
+    // Length (at least length) and offset for encoding values 0 to maxEncoded so that none starts with a
+    // character in avoid. Shared by the timestamp part and bucketKey.
+    private leadShift(avoid: string, length: number, maxEncoded: number): { length: number, offset: number } {
+        const lead = [...this.alphabet].findIndex(char => !avoid.includes(char));
+
+        // Leading characters used range from alphabet[lead] up; lengthen until that range has no avoided ones
+        for (;;) {
+            const unit = Math.pow(this.base, length - 1);
+            const last = Math.floor((lead * unit + maxEncoded) / unit);
+            if (last < this.base && !this.alphabet.slice(lead, last + 1).split('').some(char => avoid.includes(char))) {
+                return { length, offset: lead * unit };
+            }
+            length++;
+        }
+    }
+
+    private timespanToDate(timespan: number, epoch: Date = this.timestampStart): Date {
+        // Round down to the decode level, counting units from the epoch like the encoding does
+        const truncateMonths = CALENDAR_MONTHS[this.decodeTruncateTo];
+        if (truncateMonths) {
+            const units = Math.floor(calendarSpan(epoch, new Date(this.timespanToMs(timespan, epoch)), truncateMonths));
+            return addCalendarMonths(epoch, units * truncateMonths);
+        }
+        const elapsedMs = this.timespanToMs(timespan, epoch) - epoch.getTime();
+        const truncateMs = this.LEVEL_TO_MS[this.decodeTruncateTo];
+        return new Date(
+            epoch.getTime() + 
+            Math.floor(elapsedMs / truncateMs) * truncateMs
+        );
+    }
+
+    // Inserts groupSeparator every groupEvery characters (a constant pattern, so sort order is kept)
+    private group(id: string): string {
+        if (!this.groupEvery) {
+            return id;
+        }
+        const groups: string[] = [];
+        for (let i = 0; i < id.length; i += this.groupEvery) {
+            groups.push(id.slice(i, i + this.groupEvery));
+        }
+        return groups.join(this.groupSeparator);
+    }
+
+    // The plain ID behind input that may be surrounded by whitespace (trimOnDecode) or grouped. Only decoding
+    // (decode and checkedId) passes debugSuffix to also strip a generateDebug() suffix; elsewhere (e.g. owns,
+    // secureEqual) such an ID is a different string and doesn't match.
+    private normalizeId(id: string, debugSuffix: boolean = false): string {
+        if (this.trimOnDecode) {
+            id = id.trim();
+        }
+        if (debugSuffix && this.indexOf(DEBUG_SUFFIX_MARK) < 0) {
+            id = id.replace(DEBUG_SUFFIX, '');
+        }
+        return this.groupSeparator ? id.split(this.groupSeparator).join('') : id;
+    }
+
+    // The plain ID behind id, as decode() reads it, after checking that it decodes
+    private checkedId(id: string): string {
+        this.decode(id);
+        return this.normalizeId(id, true);
+    }
+
+    private splitId(id: string): { versionPart: string, timestampPart: string, chronoPart: string, machineIdPart: string } {
+        const timestampOffset = this.versionPrefix.length;
+        const chronoOffset = timestampOffset + this.timestampLength;
+        const machineIdOffset = chronoOffset + this.chronoLength;
+        return {
+            versionPart: id.slice(0, timestampOffset),
+            timestampPart: id.slice(timestampOffset, chronoOffset),
+            chronoPart: id.slice(chronoOffset, machineIdOffset),
+            machineIdPart: id.slice(machineIdOffset)
+        };
+    }
+
+    private validateRandomPart(value: string, length: number): string {
+        if (typeof value !== 'string' || value.length !== length) {
+            throw new Error(`randomFunc must return exactly ${length} characters`);
+        }
+        if ([...value].some(char => this.indexOf(char) < 0)) {
+            throw new Error('randomFunc returned characters outside the alphabet');
+        }
+        return value;
+    }
+
+    // Next value in the order of alphabet, a sorted subset of this.alphabet (e.g. randomAlphabet); symbols
+    // outside it step to the next one inside, so the result still sorts after value
+    private incrementStringPart(value: string, alphabet: string = this.alphabet): string {
         const len = value.length;
         const chars = [...value];
         
         // Start from the end
         for (let i = len - 1; i >= 0; i--) {
             const currentChar = chars[i];
-            const currentIndex = this.alphabet.indexOf(currentChar);
+            const currentIndex = this.indexOf(currentChar);
+            const next = alphabet === this.alphabet
+                ? this.alphabet[currentIndex + 1]
+                : [...alphabet].find(char => this.indexOf(char) > currentIndex);
             
             // If not at max value, increment and return
-            if (currentIndex < this.alphabet.length - 1) {
-                chars[i] = this.alphabet[currentIndex + 1];
+            if (next !== undefined) {
+                chars[i] = next;
                 return chars.join('');
             }
             
             // If at max value, reset to first char and continue to next position
-            chars[i] = this.alphabet[0];
+            chars[i] = alphabet[0];
         }
         
         // If we get here, we've overflowed
-        return value.length === this.chronoLength ? this.minChronoPart : this.minMachineIdPart;
+        return alphabet[0].repeat(len);
     }
 
     private isMaxValue(value: string): boolean {
         return [...value].every(char => char === this.alphabet[this.alphabet.length - 1]);
     }
 
-    public generate(): string {
-        const now = new Date();
-        const timespan = this.getTimespan(now);
-        
+    // Works out the next ID for timespan without touching the monotonic state
+    // chronoFloor (subUnitChrono) is the smallest chrono part to use; the counter still moves past it on ties
+    private computeNext(timespan: number, chronoFloor: string = this.minChronoPart): { chronoPart: string, id: string, overflow?: boolean } {
         if (timespan >= this.maxTimestamp) {
             throw new Error('Current time exceeds maximum supported timestamp');
         }
+        if (timespan < -this.signedOffset) {
+            throw new Error('Current time is before minimum supported timestamp');
+        }
 
-        if (timespan === this.lastTimeSpan) {
+        if (timespan === this.lastTimeSpan && this.lastId !== '') {
             // Increment chrono part first
             const newChronoPart = this.incrementStringPart(this.lastChronoPart);
             
+            if (newChronoPart === this.minChronoPart && this.counterLength > 0) {
+                // Chrono part is exhausted: keep it at its maximum and let the counter take over
+                const lastMachineId = this.splitId(this.lastId).machineIdPart;
+                const counterPart = this.incrementStringPart(lastMachineId.slice(0, this.counterLength));
+                if (counterPart === this.alphabet[0].repeat(this.counterLength)) {
+                    throw new Error('Generation rate exceeded. Please wait for next timestamp or increase maxSortableRate');
+                }
+                return {
+                    chronoPart: this.lastChronoPart,
+                    id: this.versionPrefix + this.encodeTimestamp(timespan) + this.lastChronoPart +
+                        counterPart + lastMachineId.slice(this.counterLength),
+                    overflow: true
+                };
+            }
+
             if (newChronoPart === this.minChronoPart) {
-                // If chrono part is exhausted, reset it and increment machine ID part
-                this.lastChronoPart = this.minChronoPart;
-                const lastMachineId = this.lastId.slice(this.timestampLength + this.chronoLength);
-                const newMachineId = this.incrementStringPart(lastMachineId);
-                
-                if (newMachineId === this.minMachineIdPart) {
+                // If chrono part is exhausted, keep it at its maximum and increment the machine ID part
+                // (after the node prefix, or the weighted first character, which has to stay one randomWeights
+                // draws), so IDs keep sorting after the ones before the overflow. It counts in randomAlphabet,
+                // so randomCharExclude characters stay out of it.
+                const lastMachineId = this.splitId(this.lastId).machineIdPart;
+                const fixedLength = this.firstRandomWeights ? 1 : this.nodePrefix.length;
+                const randomPart = this.incrementStringPart(lastMachineId.slice(fixedLength), this.randomAlphabet);
+
+                if (randomPart === this.randomAlphabet[0].repeat(lastMachineId.length - fixedLength)) {
                     // If both chrono and machine ID are exhausted, throw error
                     throw new Error('Generation rate exceeded. Please wait for next timestamp or increase maxSortableRate');
                 }
 
-                this.lastId = this.encodeTimestamp(timespan) + this.lastChronoPart + newMachineId;
-                return this.lastId;
+                return {
+                    chronoPart: this.lastChronoPart,
+                    id: this.versionPrefix + this.encodeTimestamp(timespan) + this.lastChronoPart +
+                        lastMachineId.slice(0, fixedLength) + randomPart,
+                    overflow: true
+                };
             }
 
-            this.lastChronoPart = newChronoPart;
-            this.lastId = this.encodeTimestamp(timespan) + this.lastChronoPart + 
-                         this.lastId.slice(this.timestampLength + this.chronoLength);
-            return this.lastId;
+            const chronoPart = chronoFloor > newChronoPart ? chronoFloor : newChronoPart;
+            return {
+                chronoPart,
+                id: this.versionPrefix + this.encodeTimestamp(timespan) + chronoPart + this.splitId(this.lastId).machineIdPart
+            };
         }
 
         // New timestamp, reset chrono value
-        this.lastTimeSpan = timespan;
-        this.lastChronoPart = this.minChronoPart;
-        const timestampPart = this.encodeTimestamp(timespan);
-        const machineIdPart = this.genRandomPart();
-        this.lastId = timestampPart + this.lastChronoPart + machineIdPart;
-        return this.lastId;
+        return { chronoPart: chronoFloor, id: this.versionPrefix + this.encodeTimestamp(timespan) + chronoFloor + this.nextRandomPart() };
     }
 
-    public getMaxDate(): Date {
-        const maxTimespan = this.maxTimestamp * this.LEVEL_TO_MS[this.timestampLevel];
-        const calculatedTime = this.timestampStart.getTime() + maxTimespan;
-        
-        // JavaScript's maximum date value: 8640000000000000 (milliseconds)
-        const MAX_JS_DATE = 8640000000000000;
+    // A fresh random part for generation. peek() draws them into pendingRandomParts and the next generate()
+    // uses the same ones, so peek() keeps returning (and generate() then returns) the same ID.
+    private nextRandomPart(): string {
+        if (this.peekCursor === null) {
+            return this.pendingRandomParts.shift() ?? this.genRandomPart();
+        }
+        if (this.peekCursor === this.pendingRandomParts.length) {
+            this.pendingRandomParts.push(this.genRandomPart());
+        }
+        return this.pendingRandomParts[this.peekCursor++];
+    }
+
+    // Captures the state nextUnblocked advances; the returned function puts it back
+    private saveGenerationState(): () => void {
+        const { lastTimeSpan, lastChronoPart, lastId, overflowedUnits, lastOverflowTimespan, usedFallback, holdUnitAhead } = this;
+        const pendingRandomParts = [...this.pendingRandomParts];
+        return () => {
+            this.lastTimeSpan = lastTimeSpan;
+            this.lastChronoPart = lastChronoPart;
+            this.lastId = lastId;
+            this.overflowedUnits = overflowedUnits;
+            this.lastOverflowTimespan = lastOverflowTimespan;
+            this.usedFallback = usedFallback;
+            this.holdUnitAhead = holdUnitAhead;
+            this.pendingRandomParts = pendingRandomParts;
+        };
+    }
+
+    public generate(): string {
+        const { now, preciseMs } = this.readClock();
+        return this.generateFor(now, preciseMs);
+    }
+
+    // The current time every generation entry point (and peek) uses: with subUnitChrono, read from
+    // preciseClock alone, so mixing entry points can't step back to an earlier unit or chrono floor
+    private readClock(): { now: Date, preciseMs: number } {
+        if (this.preciseClock) {
+            const preciseMs = this.preciseClock();
+            return { now: new Date(Math.floor(preciseMs)), preciseMs };
+        }
+        const now = new Date(this.clock());
+        return { now, preciseMs: now.getTime() };
+    }
+
+    // Generates an ID along with the exact time it was generated for (before rounding to the timestamp level).
+    // When the ID is ahead of the clock (overflowFallback, or a unit held after importState), that is the
+    // start of the time unit the ID encodes.
+    public generateWithTime(): { id: string, generatedAt: Date } {
+        const { now, preciseMs } = this.readClock();
+        return this.generateTimed(now, preciseMs);
+    }
+
+    // Generates an ID for the current time shifted by offset ms, e.g. to align IDs with a partition's
+    // local epoch. Successive IDs with the same offset stay ordered; mixing offsets on one generator doesn't.
+    public generateWithEpochOffset(offset: number): string {
+        if (!Number.isFinite(offset)) {
+            throw new Error('Epoch offset must be a finite number of milliseconds');
+        }
+        const { now, preciseMs } = this.readClock();
+        const shifted = new Date(now.getTime() + offset);
+        const timespan = Math.floor(this.getTimespan(shifted, true));
+        if (isNaN(timespan) || timespan >= this.maxTimestamp || timespan < -this.signedOffset) {
+            throw new Error(`Epoch offset of ${offset} ms moves the timestamp outside the supported range`);
+        }
+        return this.generateFor(shifted, preciseMs + offset);
+    }
+
+    private generateFor(now: Date, preciseMs: number = now.getTime()): string {
+        return this.generateTimed(now, preciseMs).id;
+    }
+
+    // Generates an ID for now, along with now or, when the ID had to use a later time unit, that unit's start
+    private generateTimed(now: Date, preciseMs: number = now.getTime()): { id: string, generatedAt: Date } {
+        if (this.promotionDue(now)) {
+            this.promoteLevel();
+        }
+
+        // Attempts skipped for the blocklist only use up chrono values (and count as overflows) if a later
+        // attempt succeeds, so a failing call leaves the monotonic state as it was
+        const restore = this.saveGenerationState();
+        let id: string;
+        try {
+            id = this.nextUnblocked(now, preciseMs);
+        } catch (error) {
+            restore();
+            throw error;
+        }
+        this.pendingRandomParts = [];
+        const generatedAt = this.lastTimeSpan === this.getCurrentTimespan(now) ? now : new Date(this.timespanToMs(this.lastTimeSpan));
+        this.onGenerate?.(id, generatedAt);
+        return { id, generatedAt };
+    }
+
+    // The next (grouped) ID outside the blocklist, advancing the monotonic state past every attempt
+    private nextUnblocked(now: Date, preciseMs: number): string {
+        let { timespan, chronoFloor } = this.slotFor(now, preciseMs);
+        this.usedFallback = false;
+        for (let attempt = 0; attempt < MAX_BLOCKLIST_ATTEMPTS; attempt++) {
+            const result = this.computeNextWithFallback(timespan, chronoFloor);
+            const next = result.next;
+            if (result.usedFallback) {
+                timespan = result.timespan;
+                chronoFloor = this.minChronoPart;
+                this.usedFallback = true;
+            }
+            if (next.overflow && this.options.autoPromoteLevel && timespan !== this.lastOverflowTimespan) {
+                this.overflowedUnits++;
+                this.lastOverflowTimespan = timespan;
+            }
+            if (this.isBlocked && this.isBlocked(next.id) && !next.overflow) {
+                // The chrono part alone orders this ID, so a fresh random part is safe
+                next.id = next.id.slice(0, next.id.length - this.machineIdLength) + this.nextRandomPart();
+            }
+
+            this.lastTimeSpan = timespan;
+            this.lastChronoPart = next.chronoPart;
+            this.lastId = next.id;
+            // A blocked ID that can't be rerolled is skipped, keeping the sequence ordered
+            if (!this.isBlocked || !this.isBlocked(next.id)) {
+                if (this.usedFallback) {
+                    // Later IDs stay in the fallback unit until the clock reaches it
+                    this.holdUnitAhead = true;
+                }
+                return this.group(next.id);
+            }
+        }
+        throw new Error(`Could not generate an ID outside the blocklist in ${MAX_BLOCKLIST_ATTEMPTS} attempts`);
+    }
+
+    // Time unit of now and the smallest chrono part for it (from preciseMs with subUnitChrono), shared by
+    // generate() and peek()
+    private slotFor(now: Date, preciseMs: number): { timespan: number, chronoFloor: string } {
+        const timespan = this.getCurrentTimespan(now);
+        if (timespan >= this.lastTimeSpan) {
+            this.holdUnitAhead = false;
+        }
+        if (this.holdUnitAhead && this.lastId !== '' && timespan < this.lastTimeSpan) {
+            // A fallback or an imported state is ahead of the clock: stay in that unit until the clock catches up
+            return { timespan: this.lastTimeSpan, chronoFloor: this.minChronoPart };
+        }
+        return { timespan, chronoFloor: this.preciseClock ? this.subUnitChronoPart(preciseMs) : this.minChronoPart };
+    }
+
+    // computeNext, moving on to the next time unit when timespan is exhausted and overflowFallback is set
+    private computeNextWithFallback(timespan: number, chronoFloor: string):
+        { timespan: number, next: { chronoPart: string, id: string, overflow?: boolean }, usedFallback: boolean } {
+        try {
+            return { timespan, next: this.computeNext(timespan, chronoFloor), usedFallback: false };
+        } catch (error) {
+            if (!this.overflowFallback || !(error instanceof Error) || !error.message.startsWith('Generation rate exceeded')) {
+                throw error;
+            }
+            return { timespan: timespan + 1, next: this.computeNext(timespan + 1), usedFallback: true };
+        }
+    }
+
+    // Chrono part for the fraction of the current time unit (as last computed by getCurrentTimespan)
+    // elapsed at preciseMs
+    private subUnitChronoPart(preciseMs: number): string {
+        const capacity = this.base ** this.chronoLength;
+        const fraction = (preciseMs - this.unitStartMs) / (this.unitEndMs - this.unitStartMs);
+        const value = Math.min(capacity - 1, Math.max(0, Math.floor(fraction * capacity)));
+        return this.encodeNumber(value, this.chronoLength);
+    }
+
+    // Like generate(), also reporting when overflowFallback had to use the next time unit ahead of the clock
+    public generateWithFallback(): { id: string, warning?: string } {
+        const id = this.generate();
+        return this.usedFallback
+            ? { id, warning: 'Generation rate exceeded; the ID uses the next time unit, ahead of the clock' }
+            : { id };
+    }
+
+    // Generates n IDs in n distinct time units (so no two decode to the same time), waiting for the
+    // clock to reach each next unit. Rejects if that takes longer than maxWaitMs in total.
+    public async generateDistinctTimestamps(n: number, maxWaitMs: number = 10_000): Promise<string[]> {
+        if (!Number.isInteger(n) || n < 0) {
+            throw new Error('Count must be a non-negative integer');
+        }
+        const startMs = this.readClock().now.getTime();
+        const realStartMs = Date.now();
+        const ids: string[] = [];
+        let previous: number | null = null;
+        while (ids.length < n) {
+            const { now, preciseMs } = this.readClock();
+            if (previous === null || this.getCurrentTimespan(now) !== previous) {
+                ids.push(this.generateFor(now, preciseMs));
+                previous = this.lastTimeSpan;
+                continue;
+            }
+
+            const waitedMs = Math.max(now.getTime() - startMs, Date.now() - realStartMs);
+            if (waitedMs >= maxWaitMs) {
+                throw new Error(`Could not reach ${n} distinct time units within ${maxWaitMs} ms`);
+            }
+            const untilNextUnit = this.unitEndMs - now.getTime();
+            await new Promise(resolve => setTimeout(resolve, Math.max(1, Math.min(untilNextUnit, maxWaitMs - waitedMs))));
+        }
+        return ids;
+    }
+
+    // Like generate(), but when the current time unit has no IDs left (chrono and machine ID parts
+    // overflowed) waits for the next unit instead of throwing. waited is the time that took in ms (0 without
+    // contention), e.g. to report contention as a metric. Rejects if the wait would exceed maxWaitMs.
+    public async generateWithWait(maxWaitMs: number = 10_000): Promise<{ id: string, waited: number }> {
+        const startMs = this.readClock().now.getTime();
+        const realStartMs = Date.now();
+        for (;;) {
+            const { now, preciseMs } = this.readClock();
+            const waited = Math.max(now.getTime() - startMs, Date.now() - realStartMs);
+            try {
+                return { id: this.generateFor(now, preciseMs), waited };
+            } catch (error) {
+                if (!(error instanceof Error) || !error.message.startsWith('Generation rate exceeded')) {
+                    throw error;
+                }
+            }
+
+            if (waited >= maxWaitMs) {
+                throw new Error(`Generation rate exceeded and the next time unit was not reached within ${maxWaitMs} ms`);
+            }
+            const untilNextUnit = this.unitEndMs - now.getTime();
+            await new Promise(resolve => setTimeout(resolve, Math.max(1, Math.min(untilNextUnit, maxWaitMs - waited))));
+        }
+    }
+
+    // Whether generating for now first promotes (autoPromoteLevel): the chrono part overflowed in enough
+    // time units, and now is past the last one, so the switch happens at a unit boundary
+    private promotionDue(now: Date): boolean {
+        return this.overflowedUnits >= PROMOTE_AFTER_OVERFLOWS && this.getCurrentTimespan(now) !== this.lastTimeSpan;
+    }
+
+    // Next finer level and version promoteLevel tries, or null when there is none
+    private promotionTarget(): { level: TimestampLevel, version: number } | null {
+        const level = LEVELS_BY_PRECISION[LEVELS_BY_PRECISION.indexOf(this.timestampLevel) + 1];
+        const version = (this.version as number) + 1;
+        return level && version < this.base ? { level, version } : null;
+    }
+
+    // Switches to the next finer level and version + 1, at a time unit boundary. Stays put (and keeps
+    // overflowing) when there is no finer level or the promoted layout doesn't fit.
+    private promoteLevel(): void {
+        this.overflowedUnits = 0;
+        const pendingRandomParts = this.pendingPromotedRandomParts;
+        this.pendingPromotedRandomParts = [];
+        const target = this.promotionTarget();
+        if (!target) {
+            return;
+        }
+        const { level: finer, version } = target;
+
+        const previous = { level: this.timestampLevel, version: this.version, versionPrefix: this.versionPrefix };
+        this.version = version;
+        this.versionPrefix = this.alphabet[version];
+        try {
+            this.applyLayout(finer);
+        } catch {
+            // The finer layout doesn't fit: restore the current one, which fitted before
+            this.version = previous.version;
+            this.versionPrefix = previous.versionPrefix;
+            this.applyLayout(previous.level);
+            return;
+        }
+
+        // Start afresh at the new layout; the new version sorts every ID after the earlier ones
+        this.options.version = version;
+        this.options.timestampLevel = finer;
+        this.lastTimeSpan = 0;
+        this.lastChronoPart = this.minChronoPart;
+        this.lastId = '';
+        this.pendingRandomParts = pendingRandomParts;
+        this.lastOverflowTimespan = null;
+        this.options.onLevelPromoted?.(this.config());
+    }
+
+    // Development aid: a generated ID followed by '#' and its decoded timestamp (e.g. ...#2024-06-01T12:00:00.000Z)
+    // for eyeballing. The suffix doesn't sort and decode() ignores it, but don't store these IDs.
+    public generateDebug(): string {
+        if (this.indexOf(DEBUG_SUFFIX_MARK) >= 0) {
+            throw new Error(`Alphabet contains '${DEBUG_SUFFIX_MARK}', which marks the debug suffix`);
+        }
+        const id = this.generate();
+        return id + DEBUG_SUFFIX_MARK + this.timespanToDate(this.lastTimeSpan).toISOString();
+    }
+
+    // Generates an ID together with its components, without a separate decode
+    public generateDecoded(): GeneratedID {
+        const id = this.generate();
+        const timestamp = this.timespanToDate(this.lastTimeSpan);
+        const { chronoPart, machineIdPart } = this.splitId(this.normalizeId(id));
+        return { id, timestamp, unixMillis: timestamp.getTime(), chronoPart, machineId: machineIdPart };
+    }
+
+    // Generates an ID plus a short Crockford Base32 reference code derived from it, for showing in UIs.
+    // The code is codeLength - 1 hash characters and a check character, so typos and tampering are detected,
+    // but unlike the display form of generateDual it can't be decoded back to the ID.
+    public generateWithShortCode(codeLength: number): { id: string, shortCode: string } {
+        if (!Number.isInteger(codeLength) || codeLength < 2 || codeLength > 13) {
+            throw new Error('Short code length must be an integer between 2 and 13');
+        }
+        const id = this.generate();
+        return { id, shortCode: this.shortCode(id, codeLength) };
+    }
+
+    public verifyShortCode(id: string, code: string): boolean {
+        if (typeof code !== 'string' || code.length < 2 || code.length > 13) {
+            return false;
+        }
+        return this.shortCode(id, code.length) === code.toUpperCase();
+    }
+
+    private shortCode(id: string, codeLength: number): string {
+        // 64 hash bits give up to 12 base-32 characters
+        let hash = fnv1a64(this.normalizeId(id));
+        let code = '';
+        for (let i = 0; i < codeLength - 1; i++) {
+            code += ALPHABET_CROCKFORD_BASE32[Number(hash & BigInt(31))];
+            hash >>= BigInt(5);
+        }
+
+        let sum = 0;
+        for (let i = 0; i < code.length; i++) {
+            sum = (sum + (i + 1) * (ALPHABET_CROCKFORD_BASE32.indexOf(code[i]) + 1)) % 32;
+        }
+        return code + ALPHABET_CROCKFORD_BASE32[sum];
+    }
+
+    // storage is the full ID. display keeps its timestamp and chrono parts (dropping the machine ID part)
+    // plus a checksum character, so it's short enough to share yet recovers the exact timestamp.
+    public generateDual(): { storage: string, display: string } {
+        const storage = this.generate();
+        const { timestampPart, chronoPart } = this.splitId(this.normalizeId(storage));
+        const display = timestampPart + chronoPart;
+        return { storage, display: display + this.checksumChar(display) };
+    }
+
+    public decodeDisplay(display: string): { timestamp: Date, chronoPart: string } {
+        const length = this.timestampLength + this.chronoLength + 1;
+        if (!display || display.length !== length) {
+            throw new Error(`Display ID must be exactly ${length} characters long`);
+        }
+        if ([...display].some(char => this.indexOf(char) < 0)) {
+            throw new Error('Display ID contains invalid characters');
+        }
+
+        const body = display.slice(0, -1);
+        if (this.checksumChar(body) !== display.slice(-1)) {
+            throw new Error('Display ID checksum does not match');
+        }
+        return {
+            timestamp: this.timespanToDate(this.decodeTimespan(body.slice(0, this.timestampLength))),
+            chronoPart: body.slice(this.timestampLength)
+        };
+    }
+
+    // Generates an ID and remembers tag (e.g. a trace ID) for it, for debugging via tagFor()
+    public generateTagged(tag: string): string {
+        const id = this.generate();
+        this.tags.set(id, tag);
+        if (this.tags.size > this.tagCapacity) {
+            this.tags.delete(this.tags.keys().next().value as string);
+        }
+        return id;
+    }
+
+    public tagFor(id: string): string | undefined {
+        return this.tags.get(id);
+    }
+
+    // ID for the current time whose chrono and machine ID parts encode seq, an external monotonic sequence
+    // (e.g. from a database); IDs for increasing sequence numbers are strictly increasing.
+    // It doesn't touch the state of generate().
+    public generateFromSequence(seq: number): string {
+        const length = this.chronoLength + this.machineIdLength;
+        const capacity = Math.pow(this.base, length);
+        if (!Number.isSafeInteger(seq) || seq < 0 || seq >= capacity) {
+            throw new Error(`Sequence number must be an integer between 0 and ${Math.min(capacity, Number.MAX_SAFE_INTEGER + 1) - 1}`);
+        }
+
+        const timespan = this.getCurrentTimespan();
+        if (timespan >= this.maxTimestamp) {
+            throw new Error('Current time exceeds maximum supported timestamp');
+        }
+        if (timespan < -this.signedOffset) {
+            throw new Error('Current time is before minimum supported timestamp');
+        }
+        return this.group(this.versionPrefix + this.encodeTimestamp(timespan) + this.encodeNumber(seq, length));
+    }
+
+    // ID for an arbitrary time (e.g. backfilling), with a minimum chrono part and fresh random part.
+    // It doesn't touch the state of generate(), so IDs for the same unit are not ordered among themselves.
+    public generateAt(date: Date): string {
+        return this.group(this.rawTimestampPrefix(date) + this.minChronoPart + this.genRandomPart());
+    }
+
+    // The ID at chrono position n (as returned by rankInUnit) within date's time unit, with the given
+    // machine ID part. A pure function of its arguments, e.g. for building exact expected IDs in tests.
+    public nthInUnit(date: Date, n: number, random: string): string {
+        const slots = Math.pow(this.base, this.chronoLength);
+        if (!Number.isInteger(n) || n < 0 || n >= slots) {
+            throw new Error(`Chrono position must be an integer between 0 and ${slots - 1}`);
+        }
+        if (typeof random !== 'string' || random.length !== this.machineIdLength) {
+            throw new Error(`Machine ID part must be exactly ${this.machineIdLength} characters`);
+        }
+        if ([...random].some(char => this.indexOf(char) < 0)) {
+            throw new Error('Machine ID part contains characters outside the alphabet');
+        }
+        return this.group(this.rawTimestampPrefix(date) + this.encodeNumber(n, this.chronoLength) + random);
+    }
+
+    // Leading characters (version and timestamp) shared by every ID for date's time unit, e.g. as a range scan bound
+    // (grouped like the IDs, so it is a prefix of each of them)
+    public timestampPrefix(date: Date): string {
+        return this.group(this.rawTimestampPrefix(date));
+    }
+
+    private rawTimestampPrefix(date: Date): string {
+        return this.versionPrefix + this.encodeTimestamp(this.timespanAt(date));
+    }
+
+    // Number of distinct IDs one time unit can hold (every chrono and machine ID combination)
+    public capacity(): number {
+        return Math.pow(this.base, this.chronoLength + this.machineIdLength);
+    }
+
+    // Every ID of date's time unit in sorted order, for exhaustive tests of small configurations.
+    // Throws if the unit holds more than a million IDs.
+    public enumerateUnit(date: Date): Iterable<string> {
+        const prefix = this.rawTimestampPrefix(date);
+        const capacity = this.capacity();
+        if (capacity > MAX_ENUMERATE) {
+            throw new Error(`Time unit holds ${capacity} IDs, too many to enumerate (limit ${MAX_ENUMERATE})`);
+        }
+        const length = this.chronoLength + this.machineIdLength;
+        const encode = (value: number) => this.group(prefix + this.encodeNumber(value, length));
+        return (function* () {
+            for (let value = 0; value < capacity; value++) {
+                yield encode(value);
+            }
+        })();
+    }
+
+    // Bounds for the half-open range scan [lower, upper) covering every ID generated from start's
+    // time unit through end's: lower is the smallest ID for start, upper the smallest ID after end
+    public rangeBounds(start: Date, end: Date): { lower: string, upper: string } {
+        const startTimespan = this.timespanAt(start);
+        const endTimespan = this.timespanAt(end);
+        if (endTimespan < startTimespan) {
+            throw new Error('Range end must not be before range start');
+        }
+
+        const upperTimestamp = this.encodeTimestamp(endTimespan + 1);
+        if (upperTimestamp.length > this.timestampLength) {
+            throw new Error('Range end is in the last encodable time unit, so no ID sorts after it');
+        }
+        const minRest = this.minChronoPart + this.minMachineIdPart;
+        return {
+            lower: this.group(this.versionPrefix + this.encodeTimestamp(startTimespan) + minRest),
+            upper: this.group(this.versionPrefix + upperTimestamp + minRest)
+        };
+    }
+
+    private timespanAt(date: Date): number {
+        if (!(date instanceof Date) || isNaN(date.getTime())) {
+            throw new Error('Date must be a valid date');
+        }
+        const timespan = Math.floor(this.getTimespan(date, true));
+        if (timespan >= this.maxTimestamp) {
+            throw new Error('Date exceeds maximum supported timestamp');
+        }
+        if (timespan < -this.signedOffset) {
+            throw new Error('Date is before minimum supported timestamp');
+        }
+        return timespan;
+    }
+
+    // Chrono value the next generate() would use in the current time unit, and whether the chrono part
+    // is exhausted (further IDs in this unit then fall back to the machine ID part or fail)
+    public nextChronoSlot(): { slot: number, exhausted: boolean } {
+        if (this.getCurrentTimespan() !== this.lastTimeSpan || this.lastId === '') {
+            return { slot: 0, exhausted: false };
+        }
+        const slot = [...this.lastChronoPart].reduce((value, char) => value * this.base + this.indexOf(char), 0) + 1;
+        return { slot, exhausted: slot >= Math.pow(this.base, this.chronoLength) };
+    }
+
+    // Reserves count consecutive chrono slots in date's time unit, e.g. for a coordinator handing ID
+    // ranges to workers, and moves generate() past them. startId and endId carry the smallest and
+    // largest machine ID parts, so every ID of the block sorts within [startId, endId]. Only the clock's
+    // current unit (or the last generated one) can be reserved: generation only remembers its latest unit,
+    // so a block in a future unit would be handed out again once the clock got there.
+    public reserveBlock(date: Date, count: number): { startId: string, endId: string } {
+        if (!Number.isInteger(count) || count < 1) {
+            throw new Error('Block size must be a positive integer');
+        }
+        const timespan = this.timespanAt(date);
+        if (this.lastId !== '' && timespan < this.lastTimeSpan) {
+            throw new Error('Cannot reserve a block before the last generated time unit');
+        }
+        if (timespan > this.getCurrentTimespan() && (this.lastId === '' || timespan !== this.lastTimeSpan)) {
+            throw new Error('Cannot reserve a block in a time unit after the current one');
+        }
+
+        const first = timespan === this.lastTimeSpan && this.lastId !== ''
+            ? [...this.lastChronoPart].reduce((value, char) => value * this.base + this.indexOf(char), 0) + 1
+            : 0;
+        const slots = Math.pow(this.base, this.chronoLength);
+        if (first + count > slots) {
+            throw new Error(`Block of ${count} does not fit in the ${slots - first} chrono slots left in the time unit`);
+        }
+
+        const prefix = this.versionPrefix + this.encodeTimestamp(timespan);
+        const lastChronoPart = this.encodeNumber(first + count - 1, this.chronoLength);
+        const maxMachineIdPart = this.alphabet[this.base - 1].repeat(this.machineIdLength);
+        this.lastTimeSpan = timespan;
+        this.lastChronoPart = lastChronoPart;
+        // A block ending on the unit's last chrono slot leaves nothing for generate() in this unit: a maximal
+        // machine ID part makes the overflow path (which would otherwise land inside the block) report exhaustion
+        const exhausted = first + count === slots;
+        this.lastId = prefix + lastChronoPart + (exhausted ? maxMachineIdPart : this.genRandomPart());
+        this.pendingRandomParts = [];
+        return {
+            startId: this.group(prefix + this.encodeNumber(first, this.chronoLength) + this.minMachineIdPart),
+            endId: this.group(prefix + lastChronoPart + maxMachineIdPart)
+        };
+    }
+
+    // Returns the ID generate() would return right now, without consuming it
+    public peek(): string {
+        const { now, preciseMs } = this.readClock();
+        if (this.promotionDue(now)) {
+            const promoted = this.promotedGenerator();
+            if (promoted) {
+                // Ask a generator with the promoted layout, keeping its random parts for the promoted generate()
+                promoted.pendingRandomParts = this.pendingPromotedRandomParts;
+                const peeked = promoted.peek();
+                this.pendingPromotedRandomParts = promoted.pendingRandomParts;
+                return peeked;
+            }
+        }
+
+        // Run generation (blocklist rerolls and skips included) and put the state back, keeping the random
+        // parts it drew
+        const restore = this.saveGenerationState();
+        this.peekCursor = 0;
+        try {
+            return this.nextUnblocked(now, preciseMs);
+        } finally {
+            const pendingRandomParts = this.pendingRandomParts;
+            restore();
+            this.pendingRandomParts = pendingRandomParts;
+            this.peekCursor = null;
+        }
+    }
+
+    // A fresh generator with the layout promoteLevel would switch to, or null when it would stay put
+    private promotedGenerator(): SortableIDGenerator | null {
+        const target = this.promotionTarget();
+        if (!target) {
+            return null;
+        }
+        try {
+            return new SortableIDGenerator({
+                ...this.config(),
+                timestampLevel: target.level,
+                version: target.version,
+                decodeTruncateTo: this.options.decodeTruncateTo
+            });
+        } catch {
+            // The finer layout doesn't fit
+            return null;
+        }
+    }
+
+    public getMaxDate(): Date {
+        const calculatedTime = this.timespanToMs(this.maxTimestamp);
         
-        // If calculated time exceeds JavaScript's max date, return max date
-        if (calculatedTime > MAX_JS_DATE) {
+        // JavaScript's maximum date value: 8640000000000000 (milliseconds)
+        const MAX_JS_DATE = 8640000000000000;
+        
+        // If calculated time exceeds JavaScript's max date (calendar arithmetic gives NaN there), return max date
+        if (!(calculatedTime <= MAX_JS_DATE)) {
             return new Date(MAX_JS_DATE);
         }
         
         return new Date(calculatedTime);
     }
 
-    public decode(id: string): { timestamp: Date, chronoPart: string, machineId: string } {
+    // Milliseconds left until the timestamp space is exhausted (0 once it is)
+    public timeRemaining(): number {
+        return Math.max(0, this.getMaxDate().getTime() - this.clock().getTime());
+    }
+
+    public isExhausted(): boolean {
+        return this.timeRemaining() === 0;
+    }
+
+    // Produces n valid IDs with timestamps spread uniformly over [timestampStart, getMaxDate()), for test data
+    public sample(n: number, fillRandom: (bytes: Uint8Array) => void = bytes => { crypto.getRandomValues(bytes); }): string[] {
+        if (!Number.isInteger(n) || n < 0) {
+            throw new Error('Sample size must be a non-negative integer');
+        }
+
+        const bytes = new Uint8Array(7);
+        const ids: string[] = [];
+        for (let i = 0; i < n; i++) {
+            // 53 random bits give a uniform fraction of the timestamp range
+            fillRandom(bytes);
+            let bits = bytes[0] & 0x1f;
+            for (let j = 1; j < bytes.length; j++) {
+                bits = bits * 256 + bytes[j];
+            }
+            const timespan = Math.floor(bits / Math.pow(2, 53) * Math.floor(this.maxTimestamp));
+
+            const machineId = this.firstRandomAlphabet
+                ? this.randomString(1, fillRandom, this.firstRandomAlphabet) + this.randomString(this.machineIdLength - 1, fillRandom)
+                : this.firstRandomWeights
+                ? this.weightedChar(fillRandom) + this.randomString(this.machineIdLength - 1, fillRandom)
+                : this.nodePrefix + this.randomString(this.machineIdLength - this.nodePrefix.length, fillRandom);
+            ids.push(this.group(this.versionPrefix + this.encodeTimestamp(timespan) + this.minChronoPart + machineId));
+        }
+        return ids;
+    }
+
+    public decode(id: string): DecodedID {
+        if (id) {
+            id = this.normalizeId(id, true);
+        }
         if (!id || id.length !== this.totalLength) {
-            throw new Error(`ID must be exactly ${this.totalLength} characters long`);
+            throw new Error(this.describeLengthMismatch(id));
         }
 
-        const timestampPart = id.slice(0, this.timestampLength);
-        const chronoPart = id.slice(this.timestampLength, this.timestampLength + this.chronoLength);
-        const machineIdPart = id.slice(this.timestampLength + this.chronoLength);
+        const { versionPart, timestampPart, chronoPart, machineIdPart } = this.splitId(id);
 
         // Validate characters
-        if ([...id].some(char => !this.alphabet.includes(char))) {
+        if ([...id].some(char => this.indexOf(char) < 0)) {
             throw new Error('ID contains invalid characters');
         }
 
+        if (versionPart !== this.versionPrefix && this.options.selfDescribing) {
+            throw new Error(`ID describes a timestamp length of ${this.indexOf(versionPart)}, not ${this.timestampLength}`);
+        }
+        if (versionPart !== this.versionPrefix) {
+            throw new Error(`ID version ${this.indexOf(versionPart)} does not match generator version ${this.version}`);
+        }
+
+        const timestamp = this.decodeTimespan(timestampPart);
+        const decoded: DecodedID = { timestamp: this.timespanToDate(timestamp), chronoPart, machineId: machineIdPart };
+        if (this.version !== undefined) {
+            decoded.version = this.version;
+        }
+        if (this.nodePrefix) {
+            const node = [...machineIdPart.slice(0, this.nodePrefix.length)]
+                .reduce((value, char) => value * this.base + this.indexOf(char), 0);
+            if (this.embedsPid) {
+                decoded.pid = node;
+            } else {
+                decoded.nodeId = node;
+            }
+        }
+        if (this.counterLength > 0) {
+            decoded.counterPart = machineIdPart.slice(0, this.counterLength);
+            decoded.entropyPart = machineIdPart.slice(this.counterLength);
+        }
+        if (this.preciseClock) {
+            const chronoValue = [...chronoPart].reduce((value, char) => value * this.base + this.indexOf(char), 0);
+            const unitMs = this.timespanToMs(timestamp + 1) - this.timespanToMs(timestamp);
+            decoded.subUnitOffset = chronoValue / this.base ** this.chronoLength * unitMs;
+        }
+        return decoded;
+    }
+
+    // Just the timestamp value of id (units from timestampStart, as in decodeComponents), or null if id has
+    // the wrong length, an invalid character or another version. A hot-loop path for bucketing IDs by time:
+    // it builds no strings or objects, and takes IDs exactly as stored (no trimming, group separators or
+    // debug suffix).
+    public decodeTimespanFast(id: string): number | null {
+        if (typeof id !== 'string' || id.length !== this.totalLength) {
+            return null;
+        }
+        const codes = this.codeIndex;
+        for (let i = 0; i < id.length; i++) {
+            const code = id.charCodeAt(i);
+            if (code >= codes.length || codes[code] < 0) {
+                return null;
+            }
+        }
+        const start = this.versionPrefix.length;
+        if (start > 0 && id.charCodeAt(0) !== this.versionPrefix.charCodeAt(0)) {
+            return null;
+        }
         let timestamp = 0;
-        for (let i = 0; i < timestampPart.length; i++) {
-            timestamp = timestamp * this.base + this.alphabet.indexOf(timestampPart[i]);
+        for (let i = start; i < start + this.timestampLength; i++) {
+            timestamp = timestamp * this.base + codes[id.charCodeAt(i)];
+        }
+        return timestamp - this.signedOffset - this.leadOffset;
+    }
+
+    // Numeric values of the timestamp (units from timestampStart), chrono and machine ID parts of id.
+    // The machine ID part can exceed Number.MAX_SAFE_INTEGER, so it is a bigint.
+    public decodeComponents(id: string): { timestampValue: number, chronoValue: number, randomValue: bigint } {
+        const { timestampPart, chronoPart, machineIdPart } = this.splitId(this.checkedId(id));
+        const base = BigInt(this.base);
+        return {
+            timestampValue: this.decodeTimespan(timestampPart),
+            chronoValue: [...chronoPart].reduce((value, char) => value * this.base + this.indexOf(char), 0),
+            randomValue: [...machineIdPart].reduce((value, char) => value * base + BigInt(this.indexOf(char)), BigInt(0))
+        };
+    }
+
+    // Key shared by every ID whose timestamp falls in the same bucket (a level at least as coarse as
+    // timestampLevel), e.g. the hour of a millisecond-level ID; keys sort in bucket order
+    public bucketKey(id: string, bucket: TimestampLevel): string {
+        if (this.LEVEL_TO_MS[bucket] === undefined || this.LEVEL_TO_MS[bucket] < this.LEVEL_TO_MS[this.timestampLevel]) {
+            throw new Error(`Bucket level must not be finer than timestampLevel (${this.timestampLevel})`);
         }
+        const { timestampValue } = this.decodeComponents(id);
+        const units = Math.floor(this.spanAtLevel(new Date(this.timespanToMs(timestampValue)), bucket));
 
-        const date = new Date(
-            this.timestampStart.getTime() + 
-            timestamp * this.LEVEL_TO_MS[this.timestampLevel]
-        );
+        // Sized (and shifted past avoidLeadingChars) like the timestamp part would be at the bucket level
+        const range = this.spanAtLevel(this.getMaxDate(), bucket);
+        const offset = this.signedOffset > 0 ? Math.ceil(range) : 0;
+        const maxEncoded = offset > 0 ? 2 * offset : Math.ceil(range);
+        let length = calculateTimestampLength(this.base, maxEncoded);
+        let leadOffset = 0;
+        if (this.options.avoidLeadingChars) {
+            ({ length, offset: leadOffset } = this.leadShift(this.options.avoidLeadingChars, length, maxEncoded));
+        }
+        return this.versionPrefix + this.encodeNumber(units + offset + leadOffset, length);
+    }
+
+    // Decodes id into an event record; unlike decode it doesn't throw, but marks invalid IDs as such
+    public decodeEvent(id: string): DecodedEvent {
+        try {
+            const { timestamp } = this.decode(id);
+            return {
+                timestamp,
+                unixNanos: BigInt(timestamp.getTime()) * BigInt(1_000_000),
+                sequenceInUnit: this.decodeComponents(id).chronoValue,
+                valid: true
+            };
+        } catch {
+            return { timestamp: new Date(NaN), unixNanos: BigInt(0), sequenceInUnit: 0, valid: false };
+        }
+    }
+
+    // How many IDs this generator issued before id within the same time unit, read from the chrono part.
+    // Exact until the chrono part overflows; past that (counterInRandom, or the machine ID part taking over)
+    // the chrono part stays put, so the result is only a lower bound.
+    public rankInUnit(id: string): number {
+        return this.decodeComponents(id).chronoValue;
+    }
+
+    // How many IDs this generator could issue from a through b (inclusive), counting one per timestamp and
+    // chrono value. Exact when there is no machine ID part (allowZeroRandom); otherwise an estimate, since
+    // other generators share the same slots and overflow moves into the machine ID part. Throws for IDs
+    // this generator can't decode, or when a sorts after b.
+    public countBetween(a: string, b: string): bigint {
+        const position = (id: string) => {
+            const { timestampValue, chronoValue } = this.decodeComponents(id);
+            return BigInt(timestampValue) * BigInt(this.base) ** BigInt(this.chronoLength) + BigInt(chronoValue);
+        };
+        const start = position(a);
+        const end = position(b);
+        if (start > end) {
+            throw new Error(`ID '${a}' sorts after '${b}'`);
+        }
+        return end - start + BigInt(1);
+    }
+
+    // Deterministic order for merging streams from cloned generators: timestamp, then chrono part,
+    // then machine ID part, then the raw string. Returns -1, 0 or 1; throws for IDs this generator can't decode.
+    public totalOrder(a: string, b: string): number {
+        const partsA = this.splitId(this.checkedId(a));
+        const partsB = this.splitId(this.checkedId(b));
+        const keys: Array<[number | string, number | string]> = [
+            [this.decodeTimespan(partsA.timestampPart), this.decodeTimespan(partsB.timestampPart)],
+            [partsA.chronoPart, partsB.chronoPart],
+            [partsA.machineIdPart, partsB.machineIdPart],
+            [a, b]
+        ];
+        for (const [x, y] of keys) {
+            if (x !== y) {
+                return x < y ? -1 : 1;
+            }
+        }
+        return 0;
+    }
 
-        return { timestamp: date, chronoPart, machineId: machineIdPart };
+    // Compares the timestamps of IDs written by hosts with slightly skewed clocks: -1, 0 or 1, where
+    // timestamps within clockSkewTolerance count as equal (giving up precise order for robustness to skew)
+    public compareWithSkew(a: string, b: string): number {
+        const timeA = this.timespanToMs(this.decodeComponents(a).timestampValue);
+        const timeB = this.timespanToMs(this.decodeComponents(b).timestampValue);
+        if (Math.abs(timeA - timeB) <= this.clockSkewTolerance) {
+            return 0;
+        }
+        return timeA < timeB ? -1 : 1;
+    }
+
+    // Compares two IDs in time independent of where they differ. Only matters when IDs are used as secrets
+    // (e.g. bearer tokens or capability URLs, relying on the machine ID part's entropy), where an early-exit
+    // === lets an attacker guess an ID character by character from response times. Both are normalized first,
+    // so a grouped ID equals its plain form.
+    public secureEqual(a: string, b: string): boolean {
+        if (typeof a !== 'string' || typeof b !== 'string') {
+            return false;
+        }
+        a = this.normalizeId(a);
+        b = this.normalizeId(b);
+        if (a.length !== this.totalLength || b.length !== this.totalLength) {
+            return false;
+        }
+        const bytesA = Buffer.from(a);
+        const bytesB = Buffer.from(b);
+        return bytesA.length === bytesB.length && timingSafeEqual(bytesA, bytesB);
+    }
+
+    // Public form of id for exposing it without revealing when it was made: FF1 format-preserving encryption
+    // (NIST SP 800-38G) under encryptionKey, so the result has the same length and alphabet but doesn't sort
+    public encrypt(id: string): string {
+        const key = this.requireEncryptionKey();
+        const numerals = [...this.checkedId(id)].map(char => this.indexOf(char));
+        return ff1Encrypt(key, this.base, numerals).map(i => this.alphabet[i]).join('');
+    }
+
+    // Recovers the ID behind a public form from encrypt(); throws if the result isn't a valid ID. There is no
+    // integrity check, so a tampered public form (or one encrypted under another key) may still decrypt to
+    // some other valid ID.
+    public decrypt(publicId: string): string {
+        const key = this.requireEncryptionKey();
+        if (typeof publicId !== 'string' || publicId.length !== this.totalLength) {
+            throw new Error(`Encrypted ID must be ${this.totalLength} characters long`);
+        }
+        const numerals = [...publicId].map(char => this.indexOf(char));
+        if (numerals.some(i => i < 0)) {
+            throw new Error('Encrypted ID contains invalid characters');
+        }
+        const id = ff1Decrypt(key, this.base, numerals).map(i => this.alphabet[i]).join('');
+        this.decode(id);
+        return this.group(id);
+    }
+
+    public decodeEncrypted(publicId: string): DecodedID {
+        return this.decode(this.decrypt(publicId));
+    }
+
+    private requireEncryptionKey(): Uint8Array {
+        if (!this.encryptionKey) {
+            throw new Error('Encryption needs an encryptionKey in the config');
+        }
+        return this.encryptionKey;
+    }
+
+    // Quick check for routing IDs among generators: length, alphabet, version and timestamp range.
+    // Never false for this generator's own IDs, but may be true for IDs of a generator with an overlapping layout.
+    public owns(id: string): boolean {
+        if (typeof id !== 'string') {
+            return false;
+        }
+        id = this.normalizeId(id);
+        if (id.length !== this.totalLength) {
+            return false;
+        }
+        for (const char of id) {
+            if (this.indexOf(char) < 0) {
+                return false;
+            }
+        }
+        const { versionPart, timestampPart } = this.splitId(id);
+        if (versionPart !== this.versionPrefix) {
+            return false;
+        }
+        const timespan = this.decodeTimespan(timestampPart);
+        return timespan >= -this.signedOffset && timespan < this.maxTimestamp;
+    }
+
+    // Same timestamp and chrono parts as id, with a freshly drawn machine ID part
+    public reroll(id: string): string {
+        const normalized = this.checkedId(id);
+        const { machineIdPart } = this.splitId(normalized);
+        return this.group(normalized.slice(0, normalized.length - machineIdPart.length) + this.genRandomPart());
+    }
+
+    // Packs id into an unsigned 64-bit integer with the same sort order, or returns undefined
+    // when base^totalLength doesn't fit in 64 bits
+    public pack(id: string): bigint | undefined {
+        if (!this.packFits()) {
+            return undefined;
+        }
+        const base = BigInt(this.base);
+        let value = BigInt(0);
+        for (const char of this.checkedId(id)) {
+            value = value * base + BigInt(this.indexOf(char));
+        }
+        return value;
+    }
+
+    public unpack(value: bigint): string {
+        if (!this.packFits()) {
+            throw new Error(`IDs of ${this.totalLength} symbols in base ${this.base} do not fit in 64 bits`);
+        }
+        const base = BigInt(this.base);
+        if (value < BigInt(0) || value >= base ** BigInt(this.totalLength)) {
+            throw new Error('Packed value is out of range for this generator');
+        }
+
+        let id = '';
+        for (let i = 0; i < this.totalLength; i++) {
+            id = this.alphabet[Number(value % base)] + id;
+            value /= base;
+        }
+        this.decode(id);
+        return this.group(id);
+    }
+
+    // Bytes count IDs take as strings as generate() returns them, group separators included (one byte per
+    // character with an ASCII alphabet and separator)
+    public storageBytes(count: number): number {
+        return count * this.group(this.alphabet[0].repeat(this.totalLength)).length;
+    }
+
+    // Bytes count IDs take bit-packed, each in the fewest whole bytes that hold base^totalLength values
+    // (8 for layouts pack() supports)
+    public packedStorageBytes(count: number): number {
+        const bits = (BigInt(this.base) ** BigInt(this.totalLength) - BigInt(1)).toString(2).length;
+        return count * Math.ceil(bits / 8);
+    }
+
+    // Storage needed for count IDs as strings and bit-packed, for sizing a database column or table
+    public storageEstimate(count: number): { stringBytes: number, packedBytes: number } {
+        if (!Number.isInteger(count) || count < 0) {
+            throw new Error('Count must be a non-negative integer');
+        }
+        return { stringBytes: this.storageBytes(count), packedBytes: this.packedStorageBytes(count) };
+    }
+
+    private packFits(): boolean {
+        return BigInt(this.base) ** BigInt(this.totalLength) <= BigInt(2) ** BigInt(64);
+    }
+
+    // Decodes the timestamp of an ID generated with a different timestampStart (but the same layout)
+    public decodeWithEpoch(id: string, epoch: Date): Date {
+        if (isNaN(epoch.getTime())) {
+            throw new Error('Epoch must be a valid date');
+        }
+        return this.timespanToDate(this.decodeTimespan(this.splitId(this.checkedId(id)).timestampPart), epoch);
+    }
+
+    // Whether an ID for date decodes back to exactly date: it must lie on a time unit boundary (for
+    // month and year levels, a calendar one counted from timestampStart) and on one of decodeTruncateTo
+    public canRepresentExactly(date: Date): boolean {
+        let timespan: number;
+        try {
+            timespan = this.timespanAt(date);
+        } catch {
+            return false;
+        }
+        return this.timespanToDate(timespan).getTime() === date.getTime();
+    }
+
+    // Uncertainty of any decoded timestamp in ms: one unit of timestampLevel (or of the coarser
+    // decodeTruncateTo), since IDs made anywhere in a unit decode to its start. Undefined for month and
+    // year, whose calendar units have no single length.
+    public decodePrecision(): number | undefined {
+        return CALENDAR_MONTHS[this.decodeTruncateTo] ? undefined : this.LEVEL_TO_MS[this.decodeTruncateTo];
+    }
+
+    // Decodes id and re-encodes its parts, throwing unless that reproduces id exactly
+    public verifyRoundTrip(id: string): void {
+        const decoded = this.decode(id);
+        const normalized = this.normalizeId(id, true);
+        const timespan = this.decodeTimespan(this.splitId(normalized).timestampPart);
+        const rebuilt = this.versionPrefix + this.encodeTimestamp(timespan) + decoded.chronoPart + decoded.machineId;
+        if (rebuilt !== normalized) {
+            throw new Error(`ID ${id} does not round-trip through decode (got ${rebuilt})`);
+        }
+        if (this.decodeTruncateTo === this.timestampLevel &&
+            decoded.timestamp.getTime() !== this.timespanToDate(timespan).getTime()) {
+            throw new Error(`ID ${id} decodes to an inconsistent timestamp`);
+        }
+    }
+
+    public decodeBatch(ids: string[]): DecodedID[] {
+        const decoded: DecodedID[] = new Array(ids.length);
+        for (let i = 0; i < ids.length; i++) {
+            try {
+                decoded[i] = this.decode(ids[i]);
+            } catch (error: any) {
+                throw new Error(`Invalid ID at index ${i}: ${error.message}`);
+            }
+        }
+        return decoded;
+    }
+
+    // Throws unless every ID is valid for this generator and the list is in non-decreasing order
+    public assertSorted(ids: string[]): void {
+        this.decodeBatch(ids);
+        for (let i = 1; i < ids.length; i++) {
+            if (ids[i - 1] > ids[i]) {
+                throw new Error(`IDs at index ${i - 1} and ${i} are out of order`);
+            }
+        }
+    }
+
+    // Streaming counterpart of assertSorted for ID sequences too large to hold in memory
+    public monotonicChecker(): MonotonicChecker {
+        return new MonotonicChecker(this);
+    }
+
+    public isSorted(ids: string[]): boolean {
+        try {
+            this.assertSorted(ids);
+            return true;
+        } catch {
+            return false;
+        }
+    }
+
+    // Alphabet characters that never appear in ids; with enough IDs this should be empty
+    public unusedCharacters(ids: string[]): string {
+        const used = new Set<string>();
+        for (const id of ids) {
+            for (const char of id) {
+                used.add(char);
+            }
+        }
+        return [...this.alphabet].filter(char => !used.has(char)).join('');
+    }
+
+    // RFC 3339 / ISO 8601 form of the decoded timestamp, in UTC
+    public decodeToISOString(id: string): string {
+        return this.decode(id).timestamp.toISOString();
+    }
+
+    public decodeToUnixMillis(id: string): number {
+        return this.decode(id).timestamp.getTime();
+    }
+
+    // Every setting that affects the ID layout
+    private layoutFields(): Array<string | number> {
+        return [
+            this.alphabet,
+            this.totalLength,
+            this.versionPrefix,
+            this.counterLength,
+            this.signedOffset,
+            this.leadOffset,
+            this.timestampStart.getTime(),
+            this.timestampLevel,
+            this.idsPerSecond,
+            this.timestampLength,
+            this.chronoLength,
+            this.groupEvery,
+            this.groupSeparator
+        ];
+    }
+
+    // Effective configuration with defaults applied; new SortableIDGenerator(g.config()) is equal() to g
+    public config(): IDGeneratorConfig {
+        const config: IDGeneratorConfig = {
+            ...this.options,
+            alphabet: this.alphabet,
+            totalLength: this.totalLength,
+            timestampStart: new Date(this.timestampStart),
+            timestampEnd: new Date(this.timestampEnd),
+            timestampLevel: this.timestampLevel,
+            maxSortableRate: this.maxSortableRate,
+            clock: this.clock,
+            decodeTruncateTo: this.decodeTruncateTo,
+            trimOnDecode: this.trimOnDecode,
+            tagCapacity: this.tagCapacity,
+            // Copies, so changing the returned config doesn't change this generator (or an earlier snapshot)
+            blocklist: this.options.blocklist && [...this.options.blocklist],
+            randomWeights: this.options.randomWeights && { ...this.options.randomWeights },
+            encryptionKey: this.encryptionKey ? Uint8Array.from(this.encryptionKey) : undefined
+        };
+        delete config.timestampLength;
+        return config;
+    }
+
+    // Every setting that shapes the IDs (layout and output format) as SORTABLE_NANOID_* environment variables,
+    // which fromEnv() reads back into a generator producing the same kind of IDs, e.g. to reproduce a
+    // configuration in another deployment. Functions (clock, randomFunc, hooks) and encryptionKey are left out.
+    public configEnv(): Record<string, string> {
+        const env: Record<string, string> = {
+            [`${ENV_PREFIX}ALPHABET`]: this.alphabet,
+            [`${ENV_PREFIX}TOTAL_LENGTH`]: String(this.totalLength),
+            [`${ENV_PREFIX}TIMESTAMP_LEVEL`]: this.timestampLevel,
+            [`${ENV_PREFIX}MAX_SORTABLE_RATE`]: String(this.maxSortableRate),
+            [`${ENV_PREFIX}TIMESTAMP_START`]: this.timestampStart.toISOString(),
+            [`${ENV_PREFIX}TIMESTAMP_END`]: this.timestampEnd.toISOString()
+        };
+        if (this.version !== undefined) {
+            env[`${ENV_PREFIX}VERSION`] = String(this.version);
+        }
+        if (this.chronoLength < this.derivedChronoLength) {
+            env[`${ENV_PREFIX}MAX_CHRONO_LENGTH`] = String(this.chronoLength);
+        }
+        if (this.counterLength > 0) {
+            env[`${ENV_PREFIX}COUNTER_IN_RANDOM`] = 'true';
+        }
+        if (this.signedOffset > 0) {
+            env[`${ENV_PREFIX}SIGNED_EPOCH`] = 'true';
+        }
+        if (this.options.avoidLeadingChars) {
+            env[`${ENV_PREFIX}AVOID_LEADING_CHARS`] = this.options.avoidLeadingChars;
+        }
+        if (this.options.selfDescribing) {
+            env[`${ENV_PREFIX}SELF_DESCRIBING`] = 'true';
+        }
+        if (this.options.allowZeroRandom) {
+            env[`${ENV_PREFIX}ALLOW_ZERO_RANDOM`] = 'true';
+        }
+        if (this.groupEvery > 0) {
+            env[`${ENV_PREFIX}GROUP_EVERY`] = String(this.groupEvery);
+            env[`${ENV_PREFIX}GROUP_SEPARATOR`] = this.groupSeparator;
+        }
+        if (this.options.clusterSize !== undefined) {
+            env[`${ENV_PREFIX}CLUSTER_SIZE`] = String(this.options.clusterSize);
+            env[`${ENV_PREFIX}NODE_ID`] = String(this.options.nodeId);
+        }
+        if (this.embedsPid) {
+            env[`${ENV_PREFIX}EMBED_PID`] = 'true';
+            // Without an explicit pid, each process embeds its own
+            if (this.options.pid !== undefined) {
+                env[`${ENV_PREFIX}PID`] = String(this.options.pid);
+            }
+        }
+        if (this.options.randomCharExclude) {
+            env[`${ENV_PREFIX}RANDOM_CHAR_EXCLUDE`] = this.options.randomCharExclude;
+        }
+        if (this.options.randomMinPrefix) {
+            env[`${ENV_PREFIX}RANDOM_MIN_PREFIX`] = 'true';
+        }
+        if (this.options.randomWeights) {
+            env[`${ENV_PREFIX}RANDOM_WEIGHTS`] = JSON.stringify(this.options.randomWeights);
+        }
+        if (this.options.blocklist?.length) {
+            env[`${ENV_PREFIX}BLOCKLIST`] = JSON.stringify(this.options.blocklist);
+        }
+        if (this.decodeTruncateTo !== this.timestampLevel) {
+            env[`${ENV_PREFIX}DECODE_TRUNCATE_TO`] = this.decodeTruncateTo;
+        }
+        if (this.trimOnDecode) {
+            env[`${ENV_PREFIX}TRIM_ON_DECODE`] = 'true';
+        }
+        if (this.options.autoPromoteLevel) {
+            env[`${ENV_PREFIX}AUTO_PROMOTE_LEVEL`] = 'true';
+        }
+        if (this.overflowFallback) {
+            env[`${ENV_PREFIX}OVERFLOW_FALLBACK`] = 'true';
+        }
+        if (this.options.subUnitChrono) {
+            env[`${ENV_PREFIX}SUB_UNIT_CHRONO`] = 'true';
+        }
+        return env;
+    }
+
+    // Creates a generator from the SORTABLE_NANOID_* variables configEnv() produces (unset ones keep their defaults)
+    public static fromEnv(env: Record<string, string | undefined> = process.env): SortableIDGenerator {
+        const read = (name: string): string | undefined => env[ENV_PREFIX + name];
+        const readInteger = (name: string): number | undefined => {
+            const value = read(name);
+            if (value === undefined) {
+                return undefined;
+            }
+            if (!/^\d+$/.test(value)) {
+                throw new Error(`${ENV_PREFIX}${name} must be a non-negative integer, got '${value}'`);
+            }
+            return Number(value);
+        };
+        const readDate = (name: string): Date | undefined => {
+            const value = read(name);
+            if (value === undefined) {
+                return undefined;
+            }
+            const date = new Date(value);
+            if (isNaN(date.getTime())) {
+                throw new Error(`${ENV_PREFIX}${name} must be an ISO 8601 date, got '${value}'`);
+            }
+            return date;
+        };
+        const readBoolean = (name: string): boolean | undefined => {
+            const value = read(name);
+            if (value === undefined) {
+                return undefined;
+            }
+            if (value !== 'true' && value !== 'false') {
+                throw new Error(`${ENV_PREFIX}${name} must be 'true' or 'false', got '${value}'`);
+            }
+            return value === 'true';
+        };
+        const readJSON = <T>(name: string, valid: (value: unknown) => boolean, expected: string): T | undefined => {
+            const value = read(name);
+            if (value === undefined) {
+                return undefined;
+            }
+            let parsed: unknown;
+            try {
+                parsed = JSON.parse(value);
+            } catch {
+                parsed = undefined;
+            }
+            if (!valid(parsed)) {
+                throw new Error(`${ENV_PREFIX}${name} must be ${expected}, got '${value}'`);
+            }
+            return parsed as T;
+        };
+        const readLevel = (name: string): TimestampLevel | undefined => {
+            const value = read(name);
+            if (value !== undefined && !(LEVELS_BY_PRECISION as string[]).includes(value)) {
+                throw new Error(`${ENV_PREFIX}${name} must be one of ${LEVELS_BY_PRECISION.join(', ')}, got '${value}'`);
+            }
+            return value as TimestampLevel | undefined;
+        };
+        // A named rate, or any positive number of generations per second (configEnv writes e.g. 3.858e-7)
+        const readRate = (name: string): SortableRate | undefined => {
+            const value = read(name);
+            if (value === undefined || (Object.values(MaxSortableRate) as string[]).includes(value)) {
+                return value as MaxSortableRate | undefined;
+            }
+            const rate = Number(value);
+            if (!Number.isFinite(rate) || rate <= 0) {
+                throw new Error(`${ENV_PREFIX}${name} must be a positive number or one of ` +
+                    `${Object.values(MaxSortableRate).join(', ')}, got '${value}'`);
+            }
+            return rate;
+        };
+
+        return new SortableIDGenerator({
+            alphabet: read('ALPHABET'),
+            totalLength: readInteger('TOTAL_LENGTH'),
+            timestampLevel: readLevel('TIMESTAMP_LEVEL'),
+            maxSortableRate: readRate('MAX_SORTABLE_RATE'),
+            timestampStart: readDate('TIMESTAMP_START'),
+            timestampEnd: readDate('TIMESTAMP_END'),
+            version: readInteger('VERSION'),
+            maxChronoLength: readInteger('MAX_CHRONO_LENGTH'),
+            counterInRandom: readBoolean('COUNTER_IN_RANDOM'),
+            signedEpoch: readBoolean('SIGNED_EPOCH'),
+            avoidLeadingChars: read('AVOID_LEADING_CHARS'),
+            selfDescribing: readBoolean('SELF_DESCRIBING'),
+            allowZeroRandom: readBoolean('ALLOW_ZERO_RANDOM'),
+            groupEvery: readInteger('GROUP_EVERY'),
+            groupSeparator: read('GROUP_SEPARATOR'),
+            clusterSize: readInteger('CLUSTER_SIZE'),
+            nodeId: readInteger('NODE_ID'),
+            embedPid: readBoolean('EMBED_PID'),
+            pid: readInteger('PID'),
+            randomCharExclude: read('RANDOM_CHAR_EXCLUDE'),
+            randomMinPrefix: readBoolean('RANDOM_MIN_PREFIX'),
+            randomWeights: readJSON<Record<string, number>>('RANDOM_WEIGHTS',
+                value => typeof value === 'object' && value !== null && !Array.isArray(value), 'a JSON object'),
+            blocklist: readJSON<string[]>('BLOCKLIST',
+                value => Array.isArray(value) && value.every(entry => typeof entry === 'string'), 'a JSON array of strings'),
+            decodeTruncateTo: readLevel('DECODE_TRUNCATE_TO'),
+            trimOnDecode: readBoolean('TRIM_ON_DECODE'),
+            autoPromoteLevel: readBoolean('AUTO_PROMOTE_LEVEL'),
+            overflowFallback: readBoolean('OVERFLOW_FALLBACK'),
+            subUnitChrono: readBoolean('SUB_UNIT_CHRONO')
+        });
+    }
+
+    // A generator with the same configuration but another clock and fresh monotonic state, e.g. for tests.
+    // This generator is left as it is; apart from that state (and autoPromoteLevel) generators never change.
+    public withClock(clock: () => Date): SortableIDGenerator {
+        return new SortableIDGenerator({ ...this.config(), clock });
+    }
+
+    // True when both generators produce mutually comparable and decodable IDs
+    public equal(other: SortableIDGenerator): boolean {
+        const mine = this.layoutFields();
+        const theirs = other.layoutFields();
+        return mine.length === theirs.length && mine.every((value, i) => value === theirs[i]);
+    }
+
+    public fingerprint(): string {
+        // FNV-1a (64-bit) over the layout fields
+        return fnv1a64(this.layoutFields().join('|')).toString(16).padStart(16, '0');
+    }
+
+    public exportState(): GeneratorState {
+        return {
+            fingerprint: this.fingerprint(),
+            lastTimeSpan: this.lastTimeSpan,
+            lastChronoPart: this.lastChronoPart,
+            lastId: this.lastId
+        };
+    }
+
+    // If this host's clock lags the primary's, generate() stays in the imported time unit until it catches up
+    public importState(state: GeneratorState): void {
+        if (state.fingerprint !== this.fingerprint()) {
+            throw new Error('State was exported by a generator with a different configuration');
+        }
+        if (!Number.isSafeInteger(state.lastTimeSpan) || state.lastTimeSpan < -this.signedOffset ||
+            state.lastTimeSpan >= this.maxTimestamp) {
+            throw new Error('State lastTimeSpan is out of range for this generator');
+        }
+        if (state.lastId !== '') {
+            if (state.lastId.length !== this.totalLength) {
+                throw new Error(`State lastId must be exactly ${this.totalLength} characters long`);
+            }
+            // Characters and version prefix, which the checks against the other fields below don't cover
+            try {
+                this.decode(state.lastId);
+            } catch (error) {
+                throw new Error(`State lastId is invalid for this generator: ${error instanceof Error ? error.message : error}`);
+            }
+            const { timestampPart, chronoPart } = this.splitId(state.lastId);
+            if (chronoPart !== state.lastChronoPart) {
+                throw new Error('State lastChronoPart does not match lastId');
+            }
+            if (this.decodeTimespan(timestampPart) !== state.lastTimeSpan) {
+                throw new Error('State lastTimeSpan does not match lastId');
+            }
+        }
+        if (state.lastChronoPart.length !== this.chronoLength ||
+            [...state.lastChronoPart].some(char => this.indexOf(char) < 0)) {
+            throw new Error('State lastChronoPart is invalid for this generator');
+        }
+
+        this.lastTimeSpan = state.lastTimeSpan;
+        this.lastChronoPart = state.lastChronoPart;
+        this.lastId = state.lastId;
+        this.pendingRandomParts = [];
+        this.pendingPromotedRandomParts = [];
+        this.holdUnitAhead = state.lastId !== '';
+    }
+
+    private formatRate(): string {
+        return typeof this.maxSortableRate === 'number'
+            ? `${this.maxSortableRate}_per_second`
+            : this.maxSortableRate;
+    }
+
+    // Number of distinct time units IDs can be generated for (capped at Number.MAX_SAFE_INTEGER)
+    public totalTimeUnits(): number {
+        return Math.min(Math.ceil(this.maxTimestamp) + this.signedOffset, Number.MAX_SAFE_INTEGER);
+    }
+
+    // Advisory findings about the configuration that don't make it invalid, as readable messages
+    public analyzeConfig(): string[] {
+        const warnings: string[] = [];
+        // Once the chrono part overflows, the counter (counterInRandom) or the random symbols after the
+        // node prefix are incremented instead; with fewer of those than chrono symbols a burst that
+        // overflows the chrono part exhausts the time unit almost immediately
+        const overflowLength = this.counterLength > 0 ? this.counterLength : this.machineIdLength - this.nodePrefix.length;
+        if (overflowLength > 0 && overflowLength < this.chronoLength) {
+            warnings.push(`Chrono part has ${this.chronoLength} symbols but only ${overflowLength} machine ID symbols ` +
+                'take over when it overflows, leaving little headroom for bursts; lower maxChronoLength or increase totalLength');
+        }
+        return warnings;
     }
 
     public printInfo(): {
         timestampLength: number;
         chronoLength: number;
+        derivedChronoLength: number;
         startDate: Date;
         endDate: Date;
         timestampLevel: TimestampLevel;
-        maxSortableRate: MaxSortableRate;
+        maxSortableRate: SortableRate;
         alphabet: string;
         totalLength: number;
+        totalTimeUnits: number;
+        decodePrecision: number | undefined;
     } {
         const info = {
             timestampLength: this.timestampLength,
             chronoLength: this.chronoLength,
+            derivedChronoLength: this.derivedChronoLength,
             startDate: this.timestampStart,
             endDate: this.getMaxDate(),
             timestampLevel: this.timestampLevel,
             maxSortableRate: this.maxSortableRate,
             alphabet: this.alphabet,
-            totalLength: this.totalLength
+            totalLength: this.totalLength,
+            totalTimeUnits: this.totalTimeUnits(),
+            decodePrecision: this.decodePrecision()
         };
 
         console.log('\nID Generator Configuration:');
         console.log(`Timestamp Length: ${info.timestampLength} symbols`);
-        console.log(`Chrono Length: ${info.chronoLength} symbols`);
+        console.log(`Chrono Length: ${info.chronoLength} symbols` +
+            (info.chronoLength < info.derivedChronoLength ? ` (capped from ${info.derivedChronoLength})` : ''));
         console.log(`Start Date: ${info.startDate.toISOString()}`);
         console.log(`End Date: ${info.endDate.toISOString()}`);
         console.log(`Timestamp Level: ${info.timestampLevel}`);
-        console.log(`Max Sortable Rate: ${info.maxSortableRate}`);
+        console.log(`Max Sortable Rate: ${this.formatRate()}`);
         console.log(`Alphabet (${info.alphabet.length} chars): ${info.alphabet}`);
         console.log(`Total ID Length: ${info.totalLength} symbols`);
+        console.log(`Total Time Units: ${info.totalTimeUnits} ${info.timestampLevel}s`);
+        console.log(`Decode Precision: ${info.decodePrecision !== undefined
+            ? `${info.decodePrecision} ms`
+            : `one calendar ${this.decodeTruncateTo} (varies in length)`}`);
+        for (const warning of this.analyzeConfig()) {
+            console.log(`Warning: ${warning}`);
+        }
         
         return info;
     }
-}
\ No newline at end of file
+}
+
+// Checks a stream of IDs one at a time, remembering only the previous one: each must be valid for the
+// generator and not sort before its predecessor (the same order assertSorted requires)
+export class MonotonicChecker {
+    private previous: string | null = null;
+    private position: number = 0;
+
+    constructor(private readonly generator: SortableIDGenerator) {}
+
+    // Throws for the first invalid or out-of-order ID, naming it and its 0-based position in the stream
+    public check(id: string): void {
+        const position = this.position;
+        try {
+            this.generator.decode(id);
+        } catch (error) {
+            throw new Error(`Invalid ID '${id}' at position ${position}: ${error instanceof Error ? error.message : error}`);
+        }
+        if (this.previous !== null && id < this.previous) {
+            throw new Error(`ID '${id}' at position ${position} sorts before the previous ID '${this.previous}'`);
+        }
+        this.previous = id;
+        this.position++;
+    }
+
+    // Number of IDs accepted so far
+    public count(): number {
+        return this.position;
+    }
+}
+
+// Generator that reads IDs of a stored config, which may have expired long ago: its clock is pinned to the
+// epoch and the blocklist (generation only) is dropped, so the constructor's checks against the current time
+// (max date in the past, blocklist feasibility) don't reject it. Layout errors still throw.
+function readingGenerator(config: IDGeneratorConfig): SortableIDGenerator {
+    const epoch = config.timestampStart || new Date(2024, 0, 1);
+    return new SortableIDGenerator({ ...config, clock: () => epoch, blocklist: undefined, blocklistFunc: undefined });
+}
+
+// One-shot check of an ID against a stored config (length, alphabet, version and timestamp range),
+// without keeping a generator around. Throws a descriptive error when the ID doesn't match.
+export function verifyID(id: string, config: IDGeneratorConfig): void {
+    const generator = readingGenerator(config);
+    generator.decode(id);
+    if (!generator.owns(id)) {
+        throw new Error('ID timestamp is outside the range of the configuration');
+    }
+}
+
+// Decodes id with whichever of configs produced it, judged by length, alphabet, version and timestamp range.
+// Configs with the same layout (fingerprint) count as one; throws if id fits several different layouts.
+// Expired configs still match their IDs, and invalid ones are skipped.
+export function decodeAny(configs: IDGeneratorConfig[], id: string): { decoded: DecodedID, config: IDGeneratorConfig } {
+    let match: { decoded: DecodedID, config: IDGeneratorConfig, fingerprint: string, index: number } | null = null;
+    for (let index = 0; index < configs.length; index++) {
+        const config = configs[index];
+        let generator: SortableIDGenerator;
+        try {
+            generator = readingGenerator(config);
+        } catch {
+            // A config that can't describe a layout matches no ID
+            continue;
+        }
+        if (!generator.owns(id)) {
+            continue;
+        }
+        let decoded: DecodedID;
+        try {
+            decoded = generator.decode(id);
+        } catch {
+            continue;
+        }
+        const fingerprint = generator.fingerprint();
+        if (match === null) {
+            match = { decoded, config, fingerprint, index };
+        } else if (match.fingerprint !== fingerprint) {
+            throw new Error(`ID is ambiguous: it matches configurations ${match.index} and ${index}`);
+        }
+    }
+    if (match === null) {
+        throw new Error('ID does not match any of the configurations');
+    }
+    const { decoded, config } = match;
+    return { decoded, config };
+}
+
+// Timestamp of an ID from a selfDescribing generator, given only its alphabet, timestampStart and timestampLevel:
+// the leading character gives the timestamp length, so IDs of any totalLength in the family decode
+export function decodeSelfDescribing(id: string, alphabet: string, timestampStart: Date, timestampLevel: TimestampLevel): Date {
+    const sorted = [...new Set(alphabet)].sort().join('');
+    const values = [...id].map(char => sorted.indexOf(char));
+    if (values.length < 2 || values.some(value => value < 0)) {
+        throw new Error('ID must be at least 2 characters of the alphabet');
+    }
+    const timestampLength = values[0];
+    // Every layout has at least one chrono symbol after the timestamp (the machine ID part can be empty
+    // with allowZeroRandom)
+    if (timestampLength < 1 || 1 + timestampLength + 1 > id.length) {
+        throw new Error(`ID's length character describes a timestamp length of ${timestampLength}, which doesn't fit in ${id.length} characters`);
+    }
+
+    const timespan = values.slice(1, 1 + timestampLength).reduce((value, digit) => value * sorted.length + digit, 0);
+    const unitMonths = CALENDAR_MONTHS[timestampLevel];
+    return unitMonths
+        ? addCalendarMonths(timestampStart, timespan * unitMonths)
+        : new Date(timestampStart.getTime() + timespan * LEVEL_TO_MS[timestampLevel]);
+}
@@ -0,0 +1,31 @@
+import { SortableIDGenerator } from './sortable-id';
+import type { IDGeneratorConfig, DecodedID } from './sortable-id';
+
+// A string ID branded with its kind, so e.g. user IDs and order IDs can't be mixed up at compile time
+export type TypedID<K extends string> = string & { readonly __idKind: K };
+
+export class TypedGenerator<K extends string> {
+    private readonly generator: SortableIDGenerator;
+
+    constructor(config: IDGeneratorConfig = {}) {
+        this.generator = new SortableIDGenerator(config);
+    }
+
+    public generate(): TypedID<K> {
+        return this.generator.generate() as TypedID<K>;
+    }
+
+    public decode(id: TypedID<K>): DecodedID {
+        return this.generator.decode(id);
+    }
+
+    // Brands an ID read back from storage, after checking it decodes with this generator
+    public parse(id: string): TypedID<K> {
+        this.generator.decode(id);
+        return id as TypedID<K>;
+    }
+
+    public unwrap(): SortableIDGenerator {
+        return this.generator;
+    }
+}
@@ -0,0 +1,49 @@
+import {
+    AlphabetContext,
+    ALPHABET_DNS_SAFE,
+    ALPHABET_FILENAME_SAFE,
+    ALPHABET_URL_PATH_SAFE,
+    validateAlphabetForContext,
+    assertDisjoint
+} from '../src/alphabets';
+import { SortableIDGenerator } from '../src/sortable-id';
+
+describe('validateAlphabetForContext', () => {
+    it('should accept each preset in its own context', () => {
+        expect(() => validateAlphabetForContext(ALPHABET_DNS_SAFE, AlphabetContext.DNS)).not.toThrow();
+        expect(() => validateAlphabetForContext(ALPHABET_FILENAME_SAFE, AlphabetContext.Filename)).not.toThrow();
+        expect(() => validateAlphabetForContext(ALPHABET_URL_PATH_SAFE, AlphabetContext.URLPath)).not.toThrow();
+    });
+
+    it('should reject characters outside the context', () => {
+        expect(() => validateAlphabetForContext('abc_', AlphabetContext.DNS)).toThrow('not safe for dns');
+        expect(() => validateAlphabetForContext('abc:', AlphabetContext.Filename)).toThrow('not safe for filename');
+        expect(() => validateAlphabetForContext('abc/', AlphabetContext.URLPath)).toThrow('not safe for url_path');
+    });
+
+    it('should flag the default alphabet leading with "-"', () => {
+        const defaultAlphabet = new SortableIDGenerator().printInfo().alphabet;
+        expect(() => validateAlphabetForContext(defaultAlphabet, AlphabetContext.URLPath)).not.toThrow();
+        expect(() => validateAlphabetForContext(defaultAlphabet, AlphabetContext.Filename)).toThrow("'-' would lead every ID");
+    });
+
+    it('should reject mixed-case alphabets for filenames', () => {
+        expect(() => validateAlphabetForContext('0123aA', AlphabetContext.Filename)).toThrow('both cases');
+    });
+
+    it('should generate IDs from presets', () => {
+        const generator = new SortableIDGenerator({ alphabet: ALPHABET_DNS_SAFE });
+        expect(generator.generate()).toMatch(/^[a-z0-9]+$/);
+    });
+});
+
+describe('assertDisjoint', () => {
+    it('should accept separators outside the alphabet', () => {
+        expect(() => assertDisjoint(ALPHABET_DNS_SAFE, '.:')).not.toThrow();
+    });
+
+    it('should reject separators that collide with the alphabet', () => {
+        expect(() => assertDisjoint(ALPHABET_URL_PATH_SAFE, '-', 'groupSeparator'))
+            .toThrow('groupSeparator must not contain alphabet characters: -');
+    });
+});
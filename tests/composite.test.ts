@@ -0,0 +1,21 @@
+import { concat, splitConcat } from '../src/composite';
+import { SortableIDGenerator, MaxSortableRate } from '../src/sortable-id';
+
+describe('composite IDs', () => {
+    it('should split concatenated IDs back into their segments', () => {
+        const tenantGenerator = new SortableIDGenerator({ totalLength: 16, timestampLevel: 'day', maxSortableRate: MaxSortableRate.Second1 });
+        const globalGenerator = new SortableIDGenerator();
+        const tenantId = tenantGenerator.generate();
+        const globalId = globalGenerator.generate();
+
+        const composite = concat(tenantId, globalId);
+        expect(composite).toHaveLength(48);
+        expect(splitConcat(composite, 16, 32)).toEqual([tenantId, globalId]);
+    });
+
+    it('should reject mismatched lengths', () => {
+        expect(() => splitConcat('abcdef', 2, 3)).toThrow('exactly 5 characters');
+        expect(() => splitConcat('abcdef', 3, 0, 3)).toThrow('positive integers');
+        expect(() => splitConcat('abcdef')).toThrow('At least one');
+    });
+});
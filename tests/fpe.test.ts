@@ -0,0 +1,33 @@
+import { ff1Encrypt, ff1Decrypt, ff1MinLength } from '../src/fpe';
+
+const hex = (value: string) => Uint8Array.from(Buffer.from(value, 'hex'));
+const digits = '0123456789abcdefghijklmnopqrstuvwxyz';
+const numerals = (value: string) => [...value].map(char => digits.indexOf(char));
+const text = (values: number[]) => values.map(value => digits[value]).join('');
+
+describe('FF1', () => {
+    // Samples from NIST's FF1 examples for SP 800-38G
+    const samples = [
+        { key: '2B7E151628AED2A6ABF7158809CF4F3C', radix: 10, tweak: '', plaintext: '0123456789', ciphertext: '2433477484' },
+        { key: '2B7E151628AED2A6ABF7158809CF4F3C', radix: 10, tweak: '39383736353433323130', plaintext: '0123456789', ciphertext: '6124200773' },
+        { key: '2B7E151628AED2A6ABF7158809CF4F3C', radix: 36, tweak: '3737373770717273373737', plaintext: '0123456789abcdefghi', ciphertext: 'a9tv40mll9kdu509eum' },
+        { key: '2B7E151628AED2A6ABF7158809CF4F3CEF4359D8D580AA4F7F036D6F04FC6A94', radix: 10, tweak: '', plaintext: '0123456789', ciphertext: '6657667009' },
+        { key: '2B7E151628AED2A6ABF7158809CF4F3CEF4359D8D580AA4F7F036D6F04FC6A94', radix: 10, tweak: '39383736353433323130', plaintext: '0123456789', ciphertext: '1001623463' },
+    ];
+
+    it('should match the NIST samples both ways', () => {
+        for (const { key, radix, tweak, plaintext, ciphertext } of samples) {
+            expect(text(ff1Encrypt(hex(key), radix, numerals(plaintext), hex(tweak)))).toBe(ciphertext);
+            expect(text(ff1Decrypt(hex(key), radix, numerals(ciphertext), hex(tweak)))).toBe(plaintext);
+        }
+    });
+
+    it('should reject bad keys, radixes and short inputs', () => {
+        const key = hex('2B7E151628AED2A6ABF7158809CF4F3C');
+        expect(() => ff1Encrypt(key.subarray(0, 10), 10, numerals('0123456789'))).toThrow('16, 24 or 32 bytes');
+        expect(() => ff1Encrypt(key, 1, numerals('0000000000'))).toThrow('radix must be');
+        expect(ff1MinLength(10)).toBe(6);
+        expect(ff1MinLength(64)).toBe(4);
+        expect(() => ff1Encrypt(key, 10, numerals('01234'))).toThrow('at least 6 numerals');
+    });
+});
@@ -0,0 +1,25 @@
+import { LazyGenerator } from '../src/lazy';
+import { SortableIDGenerator } from '../src/sortable-id';
+
+describe('LazyGenerator', () => {
+    it('should build the generator once, on first use', async () => {
+        const lazy = new LazyGenerator({ totalLength: 24 });
+        expect(lazy['generator']).toBeNull();
+
+        const ids = await Promise.all(Array.from({ length: 20 }, async () => {
+            await Promise.resolve();
+            return { id: lazy.generate(), generator: lazy.unwrap() };
+        }));
+        expect(ids.every(({ generator }) => generator === ids[0].generator)).toBe(true);
+        expect(ids[0].generator).toBeInstanceOf(SortableIDGenerator);
+        expect(new Set(ids.map(({ id }) => id)).size).toBe(20);
+        expect(lazy.decode(ids[0].id).timestamp).toBeInstanceOf(Date);
+    });
+
+    it('should surface a bad config on first use and keep rethrowing it', () => {
+        const lazy = new LazyGenerator({ totalLength: 3 });
+        expect(() => lazy.generate()).toThrow('Total length must be at least');
+        expect(() => lazy.decode('abc')).toThrow('Total length must be at least');
+        expect(lazy['generator']).toBeNull();
+    });
+});
@@ -1,5 +1,8 @@
 import { jest } from '@jest/globals';
-import { SortableIDGenerator, MaxSortableRate } from '../src/sortable-id';
+import { readFileSync } from 'fs';
+import { SortableIDGenerator, MaxSortableRate, rateFromPerSecond, ratePerDuration, minimumTotalLength, minimumBase, machineIdWidth, verifyID, decodeAny, decodeSelfDescribing, PID_SPACE } from '../src/sortable-id';
+import type { TimestampLevel } from '../src/sortable-id';
+import { ALPHABET_HEX, ALPHABET_BASE62, ALPHABET_DNS_SAFE, ALPHABET_URL_PATH_SAFE } from '../src/alphabets';
 
 describe('SortableIDGenerator', () => {
     it('should generate sortable IDs', () => {
@@ -109,4 +112,2673 @@ describe('SortableIDGenerator', () => {
             expect(info.maxSortableRate).toBe(rate);
         }
     });
-});
\ No newline at end of file
+
+    it('should hand over generation state to a standby generator', () => {
+        const config = { maxSortableRate: MaxSortableRate.Micro100 };
+        const primary = new SortableIDGenerator(config);
+        const standby = new SortableIDGenerator(config);
+
+        jest.useFakeTimers();
+        jest.setSystemTime(new Date('2024-02-20T12:00:00Z'));
+
+        const ids: string[] = [];
+        for (let i = 0; i < 5; i++) {
+            ids.push(primary.generate());
+        }
+
+        standby.importState(primary.exportState());
+        for (let i = 0; i < 5; i++) {
+            ids.push(standby.generate());
+        }
+
+        for (let i = 1; i < ids.length; i++) {
+            expect(ids[i] > ids[i - 1]).toBe(true);
+        }
+
+        jest.useRealTimers();
+    });
+
+    it('should not regress after importing state from a primary whose clock is ahead', () => {
+        const config = { maxSortableRate: MaxSortableRate.Micro100 };
+        let primaryNow = new Date('2024-02-20T12:00:05Z');
+        let standbyNow = new Date('2024-02-20T12:00:00Z');
+        const primary = new SortableIDGenerator({ ...config, clock: () => primaryNow });
+        const standby = new SortableIDGenerator({ ...config, clock: () => standbyNow });
+
+        const ids = [primary.generate(), primary.generate()];
+        standby.importState(primary.exportState());
+        ids.push(standby.generate(), standby.generate());
+        expect(standby.decode(ids[3]).timestamp).toEqual(primaryNow);
+
+        standbyNow = new Date('2024-02-20T12:00:06Z');
+        ids.push(standby.generate());
+        expect(standby.decode(ids[4]).timestamp).toEqual(standbyNow);
+        for (let i = 1; i < ids.length; i++) {
+            expect(ids[i] > ids[i - 1]).toBe(true);
+        }
+
+        // Once caught up, the standby follows its own clock again
+        standbyNow = new Date('2024-02-20T12:00:07Z');
+        standby.generate();
+        expect(standby.exportState().lastTimeSpan).toBeGreaterThan(primary.exportState().lastTimeSpan);
+    });
+
+    it('should reject generation state that does not fit the generator', () => {
+        const generator = new SortableIDGenerator();
+        generator.generate();
+        const state = generator.exportState();
+
+        expect(() => generator.importState({ ...state, lastTimeSpan: NaN })).toThrow('lastTimeSpan is out of range');
+        expect(() => generator.importState({ ...state, lastTimeSpan: 1.5 })).toThrow('lastTimeSpan is out of range');
+        expect(() => generator.importState({ ...state, lastTimeSpan: Infinity })).toThrow('lastTimeSpan is out of range');
+        expect(() => generator.importState({ ...state, lastTimeSpan: state.lastTimeSpan + 1 }))
+            .toThrow('lastTimeSpan does not match lastId');
+
+        // A corrupted machine ID part or version prefix passes the length and field checks
+        const corrupted = state.lastId.slice(0, -1) + '!';
+        expect(() => generator.importState({ ...state, lastId: corrupted }))
+            .toThrow('State lastId is invalid for this generator: ID contains invalid characters');
+        const versioned = new SortableIDGenerator({ version: 1 });
+        versioned.generate();
+        const versionedState = versioned.exportState();
+        const otherVersion = new SortableIDGenerator({ version: 2 }).generate();
+        expect(() => versioned.importState({ ...versionedState, lastId: otherVersion[0] + versionedState.lastId.slice(1) }))
+            .toThrow('ID version 2 does not match generator version 1');
+        generator.importState(state);
+    });
+
+    it('should reject state exported by a differently configured generator', () => {
+        const primary = new SortableIDGenerator({ maxSortableRate: MaxSortableRate.Micro100 });
+        const standby = new SortableIDGenerator({ maxSortableRate: MaxSortableRate.Second1 });
+        primary.generate();
+
+        expect(primary.fingerprint()).not.toBe(standby.fingerprint());
+        expect(() => standby.importState(primary.exportState())).toThrow('different configuration');
+    });
+
+    it('should only advance the timestamp at a genuine unit boundary', () => {
+        let now = new Date('2024-02-20T23:59:59.998Z');
+        const generator = new SortableIDGenerator({
+            timestampLevel: 'second',
+            maxSortableRate: MaxSortableRate.Second100,
+            timestampStart: new Date('2024-01-01T00:00:00Z'),
+            clock: () => now
+        });
+        const timestampLength = generator['timestampLength'];
+
+        const first = generator.generate();
+        now = new Date('2024-02-20T23:59:59.999Z');
+        const sameUnit = generator.generate();
+        now = new Date('2024-02-21T00:00:00.000Z');
+        const nextUnit = generator.generate();
+
+        expect(sameUnit.slice(0, timestampLength)).toBe(first.slice(0, timestampLength));
+        expect(sameUnit.slice(timestampLength) > first.slice(timestampLength)).toBe(true);
+        expect(nextUnit.slice(0, timestampLength) > sameUnit.slice(0, timestampLength)).toBe(true);
+        expect(generator.decode(nextUnit).timestamp).toEqual(new Date('2024-02-21T00:00:00.000Z'));
+    });
+
+    it('should create ULID-like generators', () => {
+        const generator = SortableIDGenerator.ulidLike();
+        const fixedDate = new Date('2024-06-01T12:34:56.789Z');
+        jest.useFakeTimers();
+        jest.setSystemTime(fixedDate);
+
+        const id = generator.generate();
+        expect(id).toHaveLength(26);
+        expect(id).toMatch(/^[0-9A-HJKMNP-TV-Z]+$/);
+        expect(generator.decode(id).timestamp).toEqual(fixedDate);
+
+        jest.useRealTimers();
+    });
+
+    it('should report rates that are impractical for small alphabets', () => {
+        expect(() => new SortableIDGenerator({
+            alphabet: '01',
+            totalLength: 50,
+            maxSortableRate: MaxSortableRate.Micro100
+        })).toThrow('use a larger alphabet or a lower maxSortableRate');
+
+        expect(() => new SortableIDGenerator({
+            alphabet: '01',
+            totalLength: 50,
+            maxSortableRate: MaxSortableRate.Second1
+        })).not.toThrow();
+
+        // Too short for the timestamp alone: the generic length error still applies
+        expect(() => new SortableIDGenerator({
+            alphabet: '01',
+            totalLength: 20,
+            maxSortableRate: MaxSortableRate.Micro100
+        })).toThrow('Total length must be at least');
+    });
+
+    it('should accept arbitrary per-second rates', () => {
+        expect(rateFromPerSecond(100)).toBe(MaxSortableRate.Second100);
+        expect(rateFromPerSecond(5000)).toBe(5000);
+        expect(() => rateFromPerSecond(0)).toThrow('positive number');
+
+        const chronoLength = (rate: number, alphabet: string) => new SortableIDGenerator({
+            alphabet,
+            totalLength: 40,
+            maxSortableRate: rateFromPerSecond(rate)
+        }).printInfo().chronoLength;
+
+        // 5000/s at millisecond level is 5 IDs per unit
+        expect(chronoLength(5000, '0123456789')).toBe(1);
+        // 10000/s is 10 IDs per unit, which needs 2 decimal digits
+        expect(chronoLength(10000, '0123456789')).toBe(2);
+        // 3000/s must not round 3 IDs per unit up through floating point error
+        expect(chronoLength(3000, '0123')).toBe(1);
+        // The named rates go through the same path
+        expect(chronoLength(10000, '0123456789')).toBe(
+            new SortableIDGenerator({ alphabet: '0123456789', totalLength: 40, maxSortableRate: MaxSortableRate.Milli10 })
+                .printInfo().chronoLength
+        );
+    });
+
+    it('should truncate decoded timestamps to decodeTruncateTo', () => {
+        let now = new Date('2024-03-05T10:20:30.456Z');
+        const config = {
+            timestampStart: new Date('2024-01-01T00:00:00Z'),
+            clock: () => now
+        };
+        const generator = new SortableIDGenerator({ ...config, decodeTruncateTo: 'hour' });
+        const precise = new SortableIDGenerator(config);
+
+        const first = generator.generate();
+        now = new Date('2024-03-05T10:45:00.000Z');
+        const second = generator.generate();
+
+        expect(generator.decode(first).timestamp).toEqual(new Date('2024-03-05T10:00:00Z'));
+        expect(generator.decode(second).timestamp).toEqual(new Date('2024-03-05T10:00:00Z'));
+        expect(precise.decode(first).timestamp).toEqual(new Date('2024-03-05T10:20:30.456Z'));
+        // Ordering still uses the full precision
+        expect(second > first).toBe(true);
+
+        expect(() => new SortableIDGenerator({ timestampLevel: 'hour', decodeTruncateTo: 'second' }))
+            .toThrow('must not be finer');
+    });
+
+    it('should report the time remaining before exhaustion', () => {
+        const start = new Date('2024-01-01T00:00:00Z');
+        let now = start;
+        const generator = new SortableIDGenerator({ timestampStart: start, clock: () => now });
+        const maxDate = generator.getMaxDate();
+
+        expect(generator.timeRemaining()).toBe(maxDate.getTime() - start.getTime());
+        expect(generator.isExhausted()).toBe(false);
+
+        now = new Date(maxDate.getTime() - 3_600_000);
+        expect(generator.timeRemaining()).toBe(3_600_000);
+        expect(generator.isExhausted()).toBe(false);
+        expect(() => generator.generate()).not.toThrow();
+
+        now = maxDate;
+        expect(generator.timeRemaining()).toBe(0);
+        expect(generator.isExhausted()).toBe(true);
+        expect(() => generator.generate()).toThrow('exceeds maximum supported timestamp');
+    });
+
+    it('should sample IDs across the whole timestamp range', () => {
+        const generator = new SortableIDGenerator({ timestampLevel: 'second', maxSortableRate: MaxSortableRate.Second1 });
+        const start = generator.printInfo().startDate.getTime();
+        const range = generator.getMaxDate().getTime() - start;
+
+        const ids = generator.sample(1000);
+        expect(ids).toHaveLength(1000);
+        expect(new Set(ids).size).toBe(1000);
+
+        const offsets = ids.map(id => (generator.decode(id).timestamp.getTime() - start) / range);
+        expect(Math.min(...offsets)).toBeGreaterThanOrEqual(0);
+        expect(Math.min(...offsets)).toBeLessThan(0.05);
+        expect(Math.max(...offsets)).toBeLessThan(1);
+        expect(Math.max(...offsets)).toBeGreaterThan(0.95);
+    });
+
+    it('should sample deterministically from a custom random source', () => {
+        const generator = new SortableIDGenerator();
+        const seeded = () => {
+            let state = 42;
+            return (bytes: Uint8Array) => {
+                for (let i = 0; i < bytes.length; i++) {
+                    state = (state * 1103515245 + 12345) % 2147483648;
+                    bytes[i] = state >> 16;
+                }
+            };
+        };
+        expect(generator.sample(5, seeded())).toEqual(generator.sample(5, seeded()));
+    });
+
+    it('should decode straight to ISO strings and Unix milliseconds', () => {
+        const now = new Date('2024-03-05T10:20:30.456Z');
+        const expected: Array<[TimestampLevel, string]> = [
+            ['millisecond', '2024-03-05T10:20:30.456Z'],
+            ['second', '2024-03-05T10:20:30.000Z'],
+            ['minute', '2024-03-05T10:20:00.000Z'],
+            ['hour', '2024-03-05T10:00:00.000Z'],
+            ['day', '2024-03-05T00:00:00.000Z']
+        ];
+
+        for (const [level, iso] of expected) {
+            const generator = new SortableIDGenerator({
+                timestampLevel: level,
+                timestampStart: new Date('2024-01-01T00:00:00Z'),
+                maxSortableRate: MaxSortableRate.Second1,
+                clock: () => now
+            });
+            const id = generator.generate();
+            expect(generator.decodeToISOString(id)).toBe(iso);
+            expect(generator.decodeToUnixMillis(id)).toBe(Date.parse(iso));
+        }
+    });
+
+    it('should use a custom randomFunc for the machine ID part', () => {
+        let counter = 0;
+        let now = new Date('2024-03-05T10:20:30.456Z');
+        const generator = new SortableIDGenerator({
+            alphabet: '0123456789',
+            totalLength: 30,
+            maxSortableRate: MaxSortableRate.Second100,
+            clock: () => now,
+            randomFunc: (length, alphabet) => alphabet[counter++ % alphabet.length].repeat(length)
+        });
+
+        const first = generator.generate();
+        now = new Date('2024-03-05T10:20:31.456Z');
+        const second = generator.generate();
+        expect(generator.decode(first).machineId).toMatch(/^0+$/);
+        expect(generator.decode(second).machineId).toMatch(/^1+$/);
+    });
+
+    it('should reject invalid randomFunc output', () => {
+        const tooShort = new SortableIDGenerator({ randomFunc: () => 'a' });
+        expect(() => tooShort.generate()).toThrow('randomFunc must return exactly');
+
+        const outsideAlphabet = new SortableIDGenerator({
+            alphabet: '0123456789',
+            totalLength: 30,
+            maxSortableRate: MaxSortableRate.Second100,
+            randomFunc: length => 'x'.repeat(length)
+        });
+        expect(() => outsideAlphabet.generate()).toThrow('outside the alphabet');
+    });
+
+    it('should decode batches and report the first invalid index', () => {
+        const generator = new SortableIDGenerator();
+        const ids = Array.from({ length: 5 }, () => generator.generate());
+
+        const decoded = generator.decodeBatch(ids);
+        expect(decoded).toHaveLength(5);
+        expect(decoded[3]).toEqual(generator.decode(ids[3]));
+
+        const withInvalid = [...ids];
+        withInvalid[2] = ids[2].slice(1);
+        expect(() => generator.decodeBatch(withInvalid)).toThrow('Invalid ID at index 2');
+    });
+
+    it('should enforce minEntropyBits on the machine ID part', () => {
+        const binary = { alphabet: '01', totalLength: 51, maxSortableRate: MaxSortableRate.Milli10 };
+
+        // 43 timestamp + 4 chrono symbols leave a 4-bit machine ID
+        expect(() => new SortableIDGenerator(binary)).not.toThrow();
+        expect(() => new SortableIDGenerator({ ...binary, minEntropyBits: 32 }))
+            .toThrow('Machine ID part has 4.0 bits of entropy');
+        expect(() => new SortableIDGenerator({ ...binary, totalLength: 79, minEntropyBits: 32 })).not.toThrow();
+    });
+
+    it('should peek at the next ID without consuming it', () => {
+        let now = new Date('2024-03-05T10:20:30.456Z');
+        const generator = new SortableIDGenerator({ clock: () => now });
+
+        // New timestamp: the random part is fixed once peeked
+        const peeked = generator.peek();
+        expect(generator.peek()).toBe(peeked);
+        expect(generator.generate()).toBe(peeked);
+
+        // Same timestamp: peek previews the next chrono value
+        const nextPeek = generator.peek();
+        expect(generator.peek()).toBe(nextPeek);
+        expect(nextPeek > peeked).toBe(true);
+        expect(generator.generate()).toBe(nextPeek);
+
+        now = new Date('2024-03-05T10:20:30.457Z');
+        expect(generator.peek() > nextPeek).toBe(true);
+    });
+
+    it('should encode and check a leading version character', () => {
+        const v1 = new SortableIDGenerator({ version: 1 });
+        const v2 = new SortableIDGenerator({ version: 2 });
+        const unversioned = new SortableIDGenerator();
+
+        const ids = Array.from({ length: 5 }, () => v1.generate());
+        expect(ids.every(id => id.length === 32 && id[0] === v1.printInfo().alphabet[1])).toBe(true);
+        expect([...ids].sort()).toEqual(ids);
+
+        const decoded = v1.decode(ids[0]);
+        expect(decoded.version).toBe(1);
+        expect(Math.abs(decoded.timestamp.getTime() - Date.now())).toBeLessThan(1000);
+        expect(unversioned.decode(unversioned.generate()).version).toBeUndefined();
+
+        expect(() => v2.decode(ids[0])).toThrow('ID version 1 does not match generator version 2');
+        expect(() => new SortableIDGenerator({ alphabet: '0123456789', totalLength: 30, version: 10 }))
+            .toThrow('Version must be an integer between 0 and 9');
+    });
+
+    it('should return generated IDs with their numeric timestamp', () => {
+        const now = new Date('2024-03-05T10:20:30.456Z');
+        for (const alphabet of [ALPHABET_HEX, ALPHABET_BASE62]) {
+            const generator = new SortableIDGenerator({ alphabet, totalLength: 24, clock: () => now });
+            const generated = generator.generateDecoded();
+            const decoded = generator.decode(generated.id);
+
+            expect(generated.unixMillis).toBe(now.getTime());
+            expect(generated.unixMillis).toBe(decoded.timestamp.getTime());
+            expect(generated.chronoPart).toBe(decoded.chronoPart);
+            expect(generated.machineId).toBe(decoded.machineId);
+        }
+    });
+
+    it('should derive chrono lengths from per-duration rates', () => {
+        const chronoLength = (count: number, durationMs: number, level: TimestampLevel, alphabet?: string) => new SortableIDGenerator({
+            alphabet,
+            totalLength: 40,
+            timestampLevel: level,
+            maxSortableRate: ratePerDuration(count, durationMs)
+        }).printInfo().chronoLength;
+
+        expect(ratePerDuration(1, 1000)).toBe(MaxSortableRate.Second1);
+        expect(ratePerDuration(2000, 250)).toBe(8000);
+        expect(() => ratePerDuration(1, 0)).toThrow('positive numbers');
+
+        // 2000 per 250ms: 8 per millisecond, 8000 per second
+        expect(chronoLength(2000, 250, 'millisecond', '0123456789')).toBe(1);
+        expect(chronoLength(2000, 250, 'second', '0123456789')).toBe(4);
+        expect(chronoLength(2000, 250, 'second')).toBe(3);
+        // 90 per minute: 1.5 per second rounds up to 2
+        expect(chronoLength(90, 60_000, 'second', '01')).toBe(2);
+        // 1 per 10 seconds still needs one chrono symbol per minute (6 IDs)
+        expect(chronoLength(1, 10_000, 'minute', '0123456789')).toBe(1);
+    });
+
+    it('should round-trip generated IDs across configurations', () => {
+        const configs = [
+            {},
+            { alphabet: '0123456789', totalLength: 30, maxSortableRate: MaxSortableRate.Second100 },
+            { alphabet: ALPHABET_HEX, totalLength: 24, timestampLevel: 'second' as TimestampLevel },
+            { totalLength: 16, timestampLevel: 'minute' as TimestampLevel, maxSortableRate: MaxSortableRate.Second1 },
+            { timestampLevel: 'day' as TimestampLevel, maxSortableRate: MaxSortableRate.Micro100, version: 3 }
+        ];
+
+        for (const config of configs) {
+            const generator = new SortableIDGenerator(config);
+            for (let i = 0; i < 200; i++) {
+                expect(() => generator.verifyRoundTrip(generator.generate())).not.toThrow();
+            }
+        }
+        for (const id of new SortableIDGenerator().sample(200)) {
+            expect(() => new SortableIDGenerator().verifyRoundTrip(id)).not.toThrow();
+        }
+        const debug = new SortableIDGenerator();
+        expect(() => debug.verifyRoundTrip(debug.generateDebug())).not.toThrow();
+    });
+
+    it('should keep IDs ordered past chrono overflow with counterInRandom', () => {
+        const generator = new SortableIDGenerator({
+            alphabet: '0123456789',
+            totalLength: 30,
+            maxSortableRate: MaxSortableRate.Second1,
+            counterInRandom: true,
+            clock: () => new Date('2024-03-05T10:20:30.456Z')
+        });
+        expect(generator['chronoLength']).toBe(1);
+
+        // 10 chrono values, then the counter takes over
+        const ids = Array.from({ length: 50 }, () => generator.generate());
+        for (let i = 1; i < ids.length; i++) {
+            expect(ids[i] > ids[i - 1]).toBe(true);
+        }
+
+        const first = generator.decode(ids[0]);
+        const last = generator.decode(ids[49]);
+        expect(first.counterPart).toHaveLength(8);
+        expect(first.entropyPart).toHaveLength(8);
+        expect(first.counterPart! + first.entropyPart!).toBe(first.machineId);
+        expect(Number(last.counterPart) - Number(first.counterPart)).toBe(40);
+        expect(last.entropyPart).toBe(first.entropyPart);
+    });
+
+    it('should handle configs that exactly fit timestamp and chrono', () => {
+        // 13 timestamp + 4 chrono decimal digits at the default Micro1 rate
+        const exact = { alphabet: '0123456789', totalLength: 17 };
+        expect(() => new SortableIDGenerator(exact)).toThrow('leaving no room within total length 17');
+
+        let now = new Date('2024-03-05T10:20:30.456Z');
+        const generator = new SortableIDGenerator({ ...exact, allowZeroRandom: true, clock: () => now });
+        const ids = Array.from({ length: 5 }, () => generator.generate());
+        now = new Date('2024-03-05T10:20:30.457Z');
+        ids.push(generator.generate());
+
+        expect(ids.every(id => id.length === 17)).toBe(true);
+        expect(new Set(ids).size).toBe(ids.length);
+        expect([...ids].sort()).toEqual(ids);
+
+        const decoded = generator.decode(ids[4]);
+        expect(decoded.machineId).toBe('');
+        expect(decoded.chronoPart).toBe('0004');
+        expect(() => generator.verifyRoundTrip(ids[4])).not.toThrow();
+        expect(generator.sample(3).every(id => id.length === 17)).toBe(true);
+
+        expect(() => new SortableIDGenerator({ ...exact, totalLength: 13, allowZeroRandom: true }))
+            .toThrow('Total length must be at least 17 (13 for timestamp + 4 for chrono + 0 for machine ID)');
+    });
+
+    it('should list alphabet characters unused by a set of IDs', () => {
+        const generator = new SortableIDGenerator({ alphabet: ALPHABET_HEX, totalLength: 24 });
+        expect(generator.unusedCharacters(['0123', '4567', '89ab'])).toBe('cdef');
+        expect(generator.unusedCharacters([])).toBe(ALPHABET_HEX);
+
+        expect(generator.unusedCharacters(generator.sample(500))).toBe('');
+    });
+
+    it('should refill the character pool at jittered points without reusing characters', () => {
+        const generator = new SortableIDGenerator({ poolRefillJitter: true });
+        const seen = new Map<string[], Set<number>>();
+        const refillOffsets = new Set<number>();
+        const poolSize = generator['POOL_SIZE'];
+
+        for (let i = 0; i < 5000; i++) {
+            const poolBefore = generator['charPool'];
+            const offsetBefore = generator['poolOffset'];
+            generator['getRandomChar']();
+            const pool: string[] = generator['charPool'];
+            const offset: number = generator['poolOffset'];
+
+            if (pool !== poolBefore) {
+                refillOffsets.add(offsetBefore);
+                expect(offset).toBe(1);
+            } else {
+                expect(offset).toBe(offsetBefore + 1);
+            }
+            expect(offset).toBeLessThanOrEqual(poolSize);
+
+            const used = seen.get(pool) ?? new Set<number>();
+            expect(used.has(offset - 1)).toBe(false);
+            used.add(offset - 1);
+            seen.set(pool, used);
+        }
+
+        // Refill points vary and never fall below half the pool (ignoring the initial empty pool)
+        refillOffsets.delete(0);
+        expect(refillOffsets.size).toBeGreaterThan(1);
+        expect(Math.min(...refillOffsets)).toBeGreaterThanOrEqual(poolSize / 2);
+
+        expect(generator.generate()).toHaveLength(32);
+    });
+
+    it('should trim or explain extra characters around decoded IDs', () => {
+        const generator = new SortableIDGenerator({ alphabet: ALPHABET_HEX, totalLength: 24 });
+        const trimming = new SortableIDGenerator({ alphabet: ALPHABET_HEX, totalLength: 24, trimOnDecode: true });
+        const id = generator.generate();
+
+        expect(() => generator.decode(` ${id}\n`)).toThrow('leading or trailing whitespace');
+        expect(trimming.decode(` ${id}\n`)).toEqual(generator.decode(id));
+
+        expect(() => trimming.decode(`user_${id}`)).toThrow("5 unexpected leading characters 'user_'");
+        expect(() => trimming.decode(`${id}#x`)).toThrow("2 unexpected trailing characters '#x'");
+        expect(() => trimming.decode(id.slice(1))).toThrow('ID must be exactly 24 characters long');
+    });
+
+    it('should compare generator configurations', () => {
+        const a = new SortableIDGenerator({ alphabet: 'fedcba9876543210', totalLength: 24 });
+        const b = new SortableIDGenerator({ alphabet: ALPHABET_HEX, totalLength: 24, clock: () => new Date() });
+        const c = new SortableIDGenerator({ alphabet: ALPHABET_HEX, totalLength: 25 });
+        const d = new SortableIDGenerator({ alphabet: ALPHABET_HEX, totalLength: 24, timestampStart: new Date(2025, 0, 1) });
+        const e = new SortableIDGenerator({ alphabet: ALPHABET_HEX, totalLength: 24, groupEvery: 4, groupSeparator: '-' });
+
+        expect(a.equal(b)).toBe(true);
+        expect(b.equal(a)).toBe(true);
+        expect(a.equal(c)).toBe(false);
+        expect(a.equal(d)).toBe(false);
+        expect(a.equal(e)).toBe(false);
+        expect(a.fingerprint()).not.toBe(e.fingerprint());
+    });
+
+    it('should keep excluded characters out of the machine ID part', () => {
+        const exclude = '0Oo1lI';
+        for (const poolRefillJitter of [false, true]) {
+            const generator = new SortableIDGenerator({ randomCharExclude: exclude, poolRefillJitter });
+            const counts = new Map<string, number>();
+            const machineIds = [
+                ...generator.sample(300),
+                ...Array.from({ length: 300 }, () => generator['genRandomPart']())
+            ].map(id => id.slice(-22));
+
+            for (const machineId of machineIds) {
+                for (const char of machineId) {
+                    expect(exclude.includes(char)).toBe(false);
+                    counts.set(char, (counts.get(char) ?? 0) + 1);
+                }
+            }
+
+            // 58 remaining characters, ~227 draws each
+            expect(counts.size).toBe(58);
+            expect(Math.min(...counts.values())).toBeGreaterThan(140);
+            expect(Math.max(...counts.values())).toBeLessThan(320);
+        }
+
+        expect(() => new SortableIDGenerator({ alphabet: '012', totalLength: 60, randomCharExclude: '12' }))
+            .toThrow('at least 2 characters after randomCharExclude');
+    });
+
+    it('should keep excluded characters out of machine ID parts incremented after a chrono overflow', () => {
+        const now = new Date('2024-03-05T10:20:30Z');
+        const generator = new SortableIDGenerator({
+            alphabet: ALPHABET_HEX,
+            totalLength: 16,
+            timestampLevel: 'second',
+            maxSortableRate: MaxSortableRate.Second1,
+            randomCharExclude: '0123456789',
+            // Starting near the top of the random alphabet, the first increments carry
+            randomFunc: length => 'e'.repeat(length),
+            clock: () => now
+        });
+        const machineIdLength = generator['machineIdLength'];
+
+        // 16 chrono slots, then overflow
+        const ids = Array.from({ length: 40 }, () => generator.generate());
+        expect(generator.isSorted(ids)).toBe(true);
+        expect(new Set(ids).size).toBe(ids.length);
+        for (const id of ids) {
+            expect(id.slice(-machineIdLength)).toMatch(/^[a-f]+$/);
+        }
+    });
+
+    it('should compute the minimum total length for a set of requirements', () => {
+        const YEAR_MS = 31_536_000_000;
+
+        // 10 years of seconds in decimal: 315,360,000 units -> 9 digits; 100/s -> 3 digits; 64 bits -> 20 digits
+        expect(minimumTotalLength('0123456789', 10 * YEAR_MS, 'second', MaxSortableRate.Second100, 64)).toBe(32);
+        // 1 year of days in hex: 365 units -> 3 digits; 1/s -> 86,400 per day -> 5 digits; 32 bits -> 8 digits
+        expect(minimumTotalLength(ALPHABET_HEX, YEAR_MS, 'day', MaxSortableRate.Second1, 32)).toBe(16);
+        // No entropy requirement still reserves one machine ID symbol
+        expect(minimumTotalLength(ALPHABET_HEX, YEAR_MS, 'day', MaxSortableRate.Second1, 0)).toBe(9);
+        expect(() => minimumTotalLength(ALPHABET_HEX, 1000, 'day', MaxSortableRate.Second1, 0)).toThrow('at least one unit');
+
+        // Matches what the constructor derives for its built-in 200-year range
+        const generator = new SortableIDGenerator();
+        const start = generator.printInfo().startDate;
+        const end = new Date(start);
+        end.setFullYear(end.getFullYear() + 200);
+        const info = generator.printInfo();
+        expect(minimumTotalLength(info.alphabet, end.getTime() - start.getTime(), 'millisecond', MaxSortableRate.Micro1, 6))
+            .toBe(info.timestampLength + info.chronoLength + 1);
+    });
+
+    it('should generate storage and display forms that decode to the same time', () => {
+        const generator = new SortableIDGenerator();
+        const { storage, display } = generator.generateDual();
+        const info = generator.printInfo();
+
+        expect(storage).toHaveLength(32);
+        expect(display).toHaveLength(info.timestampLength + info.chronoLength + 1);
+        expect(storage.startsWith(display.slice(0, -1))).toBe(true);
+
+        const decodedDisplay = generator.decodeDisplay(display);
+        const decodedStorage = generator.decode(storage);
+        expect(decodedDisplay.timestamp).toEqual(decodedStorage.timestamp);
+        expect(decodedDisplay.chronoPart).toBe(decodedStorage.chronoPart);
+
+        // A typo in the display form is caught by the checksum
+        const alphabet = info.alphabet;
+        const typoChar = alphabet[(alphabet.indexOf(display[3]) + 1) % alphabet.length];
+        const typo = display.slice(0, 3) + typoChar + display.slice(4);
+        expect(() => generator.decodeDisplay(typo)).toThrow('checksum does not match');
+    });
+
+    it('should honor timestampEnd and reject ranges shorter than one unit', () => {
+        const start = new Date('2024-01-01T00:00:00Z');
+        expect(() => new SortableIDGenerator({ timestampStart: start, timestampEnd: start }))
+            .toThrow('Timestamp range must span at least one unit at the configured level (millisecond)');
+        expect(() => new SortableIDGenerator({
+            timestampStart: start,
+            timestampEnd: new Date('2024-01-01T00:59:00Z'),
+            timestampLevel: 'hour'
+        })).toThrow('at least one unit');
+        expect(() => new SortableIDGenerator({ timestampStart: start, timestampEnd: new Date('2023-12-31T00:00:00Z') }))
+            .toThrow('End date cannot be before start date');
+
+        // A single-unit range still gets a timestamp symbol and can generate
+        const now = new Date('2024-01-01T00:30:00Z');
+        const generator = new SortableIDGenerator({
+            timestampStart: start,
+            timestampEnd: new Date('2024-01-01T01:00:00Z'),
+            timestampLevel: 'hour',
+            maxSortableRate: MaxSortableRate.Second1,
+            clock: () => now
+        });
+        expect(generator['timestampLength']).toBe(1);
+        expect(generator.decode(generator.generate()).timestamp).toEqual(start);
+        expect(generator.getMaxDate()).toEqual(new Date('2024-01-01T01:00:00Z'));
+    });
+
+    it('should sort IDs before and after timestampStart with signedEpoch', () => {
+        const start = new Date('2024-01-01T00:00:00Z');
+        let now = new Date('2023-06-01T00:00:00Z');
+        const generator = new SortableIDGenerator({
+            timestampStart: start,
+            timestampEnd: new Date('2034-01-01T00:00:00Z'),
+            timestampLevel: 'second',
+            maxSortableRate: MaxSortableRate.Second1,
+            signedEpoch: true,
+            clock: () => now
+        });
+
+        const times = [
+            '2014-01-01T00:00:00Z',
+            '2023-06-01T00:00:00Z',
+            '2023-12-31T23:59:59Z',
+            '2024-01-01T00:00:00Z',
+            '2024-01-01T00:00:01Z',
+            '2033-12-31T23:59:59Z'
+        ];
+        const ids = times.map(time => {
+            now = new Date(time);
+            return generator.generate();
+        });
+
+        expect([...ids].sort()).toEqual(ids);
+        ids.forEach((id, i) => expect(generator.decode(id).timestamp).toEqual(new Date(times[i])));
+
+        now = new Date('2013-12-30T00:00:00Z');
+        expect(() => generator.generate()).toThrow('before minimum supported timestamp');
+
+        const unsigned = new SortableIDGenerator({ timestampStart: start, clock: () => new Date('2023-06-01T00:00:00Z') });
+        expect(() => unsigned.generate()).toThrow('End date cannot be before start date');
+    });
+
+    it('should remember a bounded number of tags', async () => {
+        const generator = new SortableIDGenerator({ tagCapacity: 3 });
+        const ids = ['trace-1', 'trace-2', 'trace-3', 'trace-4'].map(tag => generator.generateTagged(tag));
+
+        expect(generator.tagFor(ids[0])).toBeUndefined();
+        expect(generator.tagFor(ids[1])).toBe('trace-2');
+        expect(generator.tagFor(ids[3])).toBe('trace-4');
+        expect(generator.tagFor(generator.generate())).toBeUndefined();
+
+        // Interleaved async callers each get their own tag back
+        const shared = new SortableIDGenerator({ tagCapacity: 100 });
+        const tagged = await Promise.all(Array.from({ length: 50 }, async (_, i) => {
+            await Promise.resolve();
+            return { tag: `trace-${i}`, id: shared.generateTagged(`trace-${i}`) };
+        }));
+        expect(new Set(tagged.map(t => t.id)).size).toBe(50);
+        tagged.forEach(({ tag, id }) => expect(shared.tagFor(id)).toBe(tag));
+
+        expect(() => new SortableIDGenerator({ tagCapacity: 0 })).toThrow('Tag capacity must be a positive integer');
+    });
+
+    it('should never start the machine ID part with the first alphabet character when randomMinPrefix is set', () => {
+        const generator = new SortableIDGenerator({
+            alphabet: '0123',
+            totalLength: 24,
+            timestampLevel: 'day',
+            maxSortableRate: MaxSortableRate.Second1,
+            randomMinPrefix: true
+        });
+        const counts = new Map<string, number>();
+        for (let i = 0; i < 3000; i++) {
+            const first = generator['genRandomPart']()[0];
+            counts.set(first, (counts.get(first) || 0) + 1);
+        }
+
+        expect(counts.has('0')).toBe(false);
+        for (const char of '123') {
+            expect(counts.get(char)).toBeGreaterThan(850);
+            expect(counts.get(char)).toBeLessThan(1150);
+        }
+
+        generator.sample(100).forEach(id => expect(generator.decode(id).machineId[0]).not.toBe('0'));
+        expect(() => new SortableIDGenerator({ randomMinPrefix: true, counterInRandom: true }))
+            .toThrow('randomMinPrefix cannot be combined with counterInRandom');
+    });
+
+    it('should reconstruct an equal generator from config()', () => {
+        const generator = new SortableIDGenerator({
+            alphabet: 'fedcba9876543210',
+            totalLength: 24,
+            timestampLevel: 'second',
+            maxSortableRate: MaxSortableRate.Second100,
+            counterInRandom: true,
+            version: 2
+        });
+        const config = generator.config();
+
+        expect(config.alphabet).toBe('0123456789abcdef');
+        expect(config.timestampEnd).toEqual(generator.getMaxDate());
+        expect(config.decodeTruncateTo).toBe('second');
+
+        const copy = new SortableIDGenerator(config);
+        expect(copy.equal(generator)).toBe(true);
+        expect(copy.fingerprint()).toBe(generator.fingerprint());
+        expect(new SortableIDGenerator(new SortableIDGenerator().config()).equal(new SortableIDGenerator())).toBe(true);
+
+        // Changing a returned config doesn't reach the generator or the caller's original options
+        const key = new Uint8Array(16).fill(7);
+        const keyed = new SortableIDGenerator({ blocklist: ['zz'], randomWeights: { a: 1 }, encryptionKey: key });
+        const snapshot = keyed.config();
+        expect(snapshot.encryptionKey).not.toBe(key);
+        snapshot.blocklist?.push('');
+        (snapshot.randomWeights as Record<string, number>).a = 0;
+        snapshot.encryptionKey?.fill(0);
+        expect(keyed.config().blocklist).toEqual(['zz']);
+        expect(keyed.config().randomWeights).toEqual({ a: 1 });
+        expect(keyed.config().encryptionKey).toEqual(new Uint8Array(16).fill(7));
+        expect(keyed.generate()).toHaveLength(32);
+    });
+
+    it('should derive the machine ID width from the cluster size', () => {
+        expect(machineIdWidth(1, 10)).toBe(0);
+        expect(machineIdWidth(10, 10)).toBe(1);
+        expect(machineIdWidth(11, 10)).toBe(2);
+        expect(machineIdWidth(256, 16)).toBe(2);
+        expect(machineIdWidth(257, 16)).toBe(3);
+        [2, 7, 64, 65, 1000, 4096].forEach(size => {
+            [2, 16, 64].forEach(base => {
+                const width = machineIdWidth(size, base);
+                expect(Math.pow(base, width)).toBeGreaterThanOrEqual(size);
+                if (width > 0) {
+                    expect(Math.pow(base, width - 1)).toBeLessThan(size);
+                }
+            });
+        });
+
+        const generator = new SortableIDGenerator({ alphabet: ALPHABET_HEX, totalLength: 24, clusterSize: 300, nodeId: 299 });
+        const decoded = generator.decode(generator.generate());
+        expect(decoded.machineId.startsWith('12b')).toBe(true);
+        expect(decoded.nodeId).toBe(299);
+
+        expect(() => new SortableIDGenerator({ clusterSize: 300 })).toThrow('Node ID must be an integer between 0 and 299');
+        expect(() => new SortableIDGenerator({ alphabet: ALPHABET_HEX, totalLength: 17, timestampLevel: 'second', clusterSize: 300, nodeId: 1 }))
+            .toThrow('Cluster size 300 needs 3 machine ID symbols in base 16');
+    });
+
+    it('should decode the same ID against different epochs', () => {
+        const generator = new SortableIDGenerator({ timestampLevel: 'second' });
+        const id = generator.generate();
+        const decoded = generator.decode(id).timestamp;
+
+        expect(generator.decodeWithEpoch(id, new Date(2024, 0, 1))).toEqual(decoded);
+        const earlier = generator.decodeWithEpoch(id, new Date(2020, 0, 1));
+        expect(decoded.getTime() - earlier.getTime()).toBe(new Date(2024, 0, 1).getTime() - new Date(2020, 0, 1).getTime());
+
+        expect(() => generator.decodeWithEpoch('short', new Date(2020, 0, 1))).toThrow('ID must be exactly 32 characters long');
+        expect(() => generator.decodeWithEpoch(id, new Date(NaN))).toThrow('Epoch must be a valid date');
+        const debugId = generator.generateDebug();
+        expect(generator.decodeWithEpoch(debugId, new Date(2020, 0, 1)))
+            .toEqual(generator.decodeWithEpoch(debugId.split('#')[0], new Date(2020, 0, 1)));
+    });
+
+    it('should support coarse per-minute, per-hour and per-day rates', () => {
+        jest.useFakeTimers();
+        const now = new Date(Date.UTC(2024, 5, 1));
+        jest.setSystemTime(now);
+
+        const generator = new SortableIDGenerator({
+            timestampStart: new Date(Date.UTC(2024, 0, 1)), timestampLevel: 'day', maxSortableRate: MaxSortableRate.Day1, totalLength: 12
+        });
+        expect(generator['chronoLength']).toBe(1);
+
+        const ids: string[] = [];
+        for (let day = 0; day < 5; day++) {
+            jest.setSystemTime(new Date(Date.UTC(2024, 5, 1 + day)));
+            ids.push(generator.generate());
+        }
+        expect([...ids].sort()).toEqual(ids);
+        ids.forEach((id, day) => expect(generator.decode(id).timestamp).toEqual(new Date(Date.UTC(2024, 5, 1 + day))));
+
+        expect(new SortableIDGenerator({ timestampLevel: 'hour', maxSortableRate: MaxSortableRate.Hour1 })['chronoLength']).toBe(1);
+        expect(new SortableIDGenerator({ timestampLevel: 'day', maxSortableRate: MaxSortableRate.Minute1 })['chronoLength']).toBe(2);
+        expect(new SortableIDGenerator({ alphabet: '01', timestampLevel: 'day', maxSortableRate: MaxSortableRate.Hour1 })['chronoLength']).toBe(5);
+        expect(rateFromPerSecond(1 / 60)).toBe(MaxSortableRate.Minute1);
+        expect(ratePerDuration(1, 24 * 60 * 60 * 1000)).toBe(MaxSortableRate.Day1);
+
+        jest.useRealTimers();
+    });
+
+    it('should recognize IDs it could have generated', () => {
+        const generator = new SortableIDGenerator({ alphabet: ALPHABET_HEX, totalLength: 24, version: 1 });
+        const id = generator.generate();
+        expect(generator.owns(id)).toBe(true);
+        generator.sample(50).forEach(sampled => expect(generator.owns(sampled)).toBe(true));
+
+        // Same layout: a false positive is allowed
+        expect(generator.owns(new SortableIDGenerator({ alphabet: ALPHABET_HEX, totalLength: 24, version: 1 }).generate())).toBe(true);
+
+        // Incompatible generators
+        expect(generator.owns(new SortableIDGenerator({ alphabet: ALPHABET_HEX, totalLength: 24, version: 2 }).generate())).toBe(false);
+        expect(generator.owns(new SortableIDGenerator({ alphabet: ALPHABET_HEX, totalLength: 25, version: 1 }).generate())).toBe(false);
+        expect(generator.owns(new SortableIDGenerator({ alphabet: ALPHABET_BASE62, totalLength: 24 }).generate())).toBe(false);
+        expect(generator.owns('1' + 'f'.repeat(23))).toBe(false);  // timestamp past getMaxDate()
+        expect(generator.owns('')).toBe(false);
+
+        // 4,000 seconds: timestamps 0 to 3,999 (0xf9f) can be generated, 4,000 (0xfa0) can't
+        const start = new Date(Date.UTC(2024, 0, 1));
+        const bounded = new SortableIDGenerator({
+            alphabet: ALPHABET_HEX, totalLength: 16, timestampLevel: 'second',
+            timestampStart: start, timestampEnd: new Date(start.getTime() + 4_000_000), clock: () => start
+        });
+        expect(bounded.owns('f9f' + '0'.repeat(13))).toBe(true);
+        expect(bounded.owns('fa0' + '0'.repeat(13))).toBe(false);
+    });
+
+    it('should pack small IDs into 64-bit integers that sort like the IDs', () => {
+        const generator = new SortableIDGenerator({
+            alphabet: ALPHABET_HEX,
+            totalLength: 16,
+            timestampLevel: 'second',
+            maxSortableRate: MaxSortableRate.Second100
+        });
+        const ids = generator.sample(100).sort();
+        const packed = ids.map(id => generator.pack(id) as bigint);
+
+        expect(packed.every(value => typeof value === 'bigint' && value < BigInt(2) ** BigInt(64))).toBe(true);
+        expect([...packed].sort((a, b) => (a < b ? -1 : a > b ? 1 : 0))).toEqual(packed);
+        packed.forEach((value, i) => expect(generator.unpack(value)).toBe(ids[i]));
+        expect(generator.pack(generator.unpack(BigInt(2) ** BigInt(64) - BigInt(1)))).toBe(BigInt(2) ** BigInt(64) - BigInt(1));
+
+        // 17 hex symbols need 68 bits
+        const tooLong = new SortableIDGenerator({ alphabet: ALPHABET_HEX, totalLength: 17, timestampLevel: 'second', maxSortableRate: MaxSortableRate.Second100 });
+        expect(tooLong.pack(tooLong.generate())).toBeUndefined();
+        const debugId = generator.generateDebug();
+        expect(generator.pack(debugId)).toBe(generator.pack(debugId.split('#')[0]));
+        expect(() => tooLong.unpack(BigInt(1))).toThrow('IDs of 17 symbols in base 16 do not fit in 64 bits');
+        expect(() => generator.unpack(BigInt(-1))).toThrow('Packed value is out of range for this generator');
+    });
+
+    it('should give each calendar month its own timestamp at month level', () => {
+        const timestampStart = new Date('2024-01-01T00:00:00Z');
+        const generator = new SortableIDGenerator({ timestampStart, timestampLevel: 'month', maxSortableRate: MaxSortableRate.Second1, totalLength: 16 });
+        const timestampOf = (id: string) => id.slice(0, generator['timestampLength']);
+
+        // Last and first second of every month from Dec 2023 to Apr 2025 (both Februaries, one in a leap year)
+        const moments: Date[] = [];
+        for (let month = 0; month <= 15; month++) {
+            moments.push(new Date(Date.UTC(2024, month, 0, 23, 59, 59)));
+            moments.push(new Date(Date.UTC(2024, month, 1, 0, 0, 0)));
+        }
+        moments.shift();  // Dec 31 2023 is before timestampStart
+        const timestamps = moments.map(moment => timestampOf(generator.generateAt(moment)));
+
+        for (let i = 1; i < timestamps.length; i++) {
+            if (i % 2 === 0) {
+                expect(timestamps[i] > timestamps[i - 1]).toBe(true);  // crossing into a new month
+            } else {
+                expect(timestamps[i]).toBe(timestamps[i - 1]);  // same month
+            }
+        }
+        moments.forEach(moment => {
+            const decoded = generator.decode(generator.generateAt(moment)).timestamp;
+            expect(decoded).toEqual(new Date(Date.UTC(moment.getUTCFullYear(), moment.getUTCMonth(), 1)));
+        });
+
+        const yearly = new SortableIDGenerator({ timestampStart, timestampLevel: 'year', maxSortableRate: MaxSortableRate.Day1, totalLength: 12 });
+        const lastOf2024 = yearly.generateAt(new Date('2024-12-31T23:59:59Z'));
+        const firstOf2025 = yearly.generateAt(new Date('2025-01-01T00:00:00Z'));
+        expect(firstOf2025 > lastOf2024).toBe(true);
+        expect(yearly.decode(firstOf2025).timestamp).toEqual(new Date('2025-01-01T00:00:00Z'));
+        expect(yearly.getMaxDate()).toEqual(new Date('2224-01-01T00:00:00Z'));
+    });
+
+    it('should report the number of distinct time units', () => {
+        const daily = new SortableIDGenerator({
+            timestampLevel: 'day',
+            timestampEnd: new Date(2024, 0, 11),
+            maxSortableRate: MaxSortableRate.Second1,
+            totalLength: 16,
+            clock: () => new Date(2024, 0, 2)
+        });
+        expect(daily.totalTimeUnits()).toBe(10);
+        expect(daily.printInfo().totalTimeUnits).toBe(10);
+
+        // Every unit up to the last one is usable
+        expect(() => daily.generateAt(new Date(2024, 0, 10, 23))).not.toThrow();
+        expect(() => daily.generateAt(new Date(2024, 0, 11))).toThrow('Date exceeds maximum supported timestamp');
+
+        const signed = new SortableIDGenerator({ timestampLevel: 'day', timestampEnd: new Date(2024, 0, 11), signedEpoch: true, totalLength: 24, clock: () => new Date(2024, 0, 2) });
+        expect(signed.totalTimeUnits()).toBe(20);
+        expect(new SortableIDGenerator({ timestampLevel: 'month' }).totalTimeUnits()).toBe(2400);
+    });
+
+    it('should reroll the machine ID part while keeping the timestamp', () => {
+        const generator = new SortableIDGenerator();
+        const id = generator.generate();
+        const rerolled = generator.reroll(id);
+        const original = generator.decode(id);
+        const decoded = generator.decode(rerolled);
+
+        expect(decoded.timestamp).toEqual(original.timestamp);
+        expect(decoded.chronoPart).toBe(original.chronoPart);
+        expect(decoded.machineId).not.toBe(original.machineId);
+        expect(rerolled.length).toBe(id.length);
+        expect(() => generator.reroll('not-an-id')).toThrow('ID must be exactly 32 characters long');
+
+        // A debug ID rerolls as the ID before its suffix
+        const debugId = generator.generateDebug();
+        const rerolledDebug = generator.reroll(debugId);
+        expect(rerolledDebug).toHaveLength(32);
+        expect(rerolledDebug.slice(0, 32 - original.machineId.length)).toBe(debugId.slice(0, 32 - original.machineId.length));
+    });
+
+    it('should look up alphabet indexes in constant time and reject non-members', () => {
+        const generator = new SortableIDGenerator();
+        const alphabet: string = generator['alphabet'];
+        [...alphabet].forEach((char, i) => expect(generator['indexOf'](char)).toBe(i));
+
+        ['€', 'é', ' ', '\0', '', '00', '\uD83D'].forEach(char => expect(generator['indexOf'](char)).toBe(-1));
+        expect(() => generator.decode('€'.repeat(32))).toThrow('ID contains invalid characters');
+    });
+
+    it('should return the exact generation time alongside the ID', () => {
+        let now = new Date('2024-03-05T10:20:30.456Z');
+        const generator = new SortableIDGenerator({ timestampLevel: 'second', clock: () => now });
+
+        const { id, generatedAt } = generator.generateWithTime();
+        expect(generatedAt).toEqual(now);
+        expect(generator.decode(id).timestamp).toEqual(new Date(Math.floor(generatedAt.getTime() / 1000) * 1000));
+
+        now = new Date('2024-03-05T10:20:31.999Z');
+        const next = generator.generateWithTime();
+        expect(next.generatedAt).toEqual(now);
+        expect(generator.decode(next.id).timestamp).toEqual(new Date('2024-03-05T10:20:31Z'));
+        expect(next.id > id).toBe(true);
+
+        // An ID overflowFallback moves to the next unit reports that unit's start, ahead of the clock
+        const generatedAts: Date[] = [];
+        const fallback = new SortableIDGenerator({
+            alphabet: ALPHABET_HEX, totalLength: 12, timestampLevel: 'second', maxSortableRate: MaxSortableRate.Second1,
+            overflowFallback: true, randomFunc: length => 'f'.repeat(length), clock: () => now,
+            onGenerate: (_, generatedAt) => generatedAts.push(generatedAt)
+        });
+        for (let i = 0; i < 16; i++) {
+            expect(fallback.generateWithTime().generatedAt).toEqual(now);
+        }
+        const ahead = fallback.generateWithTime();
+        expect(ahead.generatedAt).toEqual(new Date('2024-03-05T10:20:32Z'));
+        expect(fallback.decode(ahead.id).timestamp).toEqual(ahead.generatedAt);
+        expect(generatedAts[16]).toEqual(ahead.generatedAt);
+    });
+
+    it('should define a total order over IDs from cloned generators', () => {
+        const generator = new SortableIDGenerator({ alphabet: ALPHABET_HEX, totalLength: 24, timestampLevel: 'second' });
+        const prefix = generator.generate().slice(0, 16);
+
+        // Colliding timestamp and chrono parts, differing only in the machine ID part
+        const low = prefix + '00000001';
+        const high = prefix + '0000000f';
+        expect(generator.totalOrder(low, high)).toBe(-1);
+        expect(generator.totalOrder(high, low)).toBe(1);
+        expect(generator.totalOrder(low, low)).toBe(0);
+
+        const later = generator.generate();
+        const merged = [later, high, low, prefix + '00000000'].sort((a, b) => generator.totalOrder(a, b));
+        expect(merged).toEqual([prefix + '00000000', low, high, later]);
+        expect(() => generator.totalOrder(low, 'zz')).toThrow('ID must be exactly 24 characters long');
+        // A debug ID orders by its parts, not by the suffix
+        const debugId = generator.generateDebug();
+        expect(generator.totalOrder(debugId, later)).toBe(1);
+        expect(generator.totalOrder(high, debugId)).toBe(-1);
+    });
+
+    it('should reject alphabets too large for a random byte to select from', () => {
+        const alphabetOfSize = (size: number) => Array.from({ length: size }, (_, i) => String.fromCharCode(0x100 + i)).join('');
+
+        const largest = new SortableIDGenerator({ alphabet: alphabetOfSize(256), totalLength: 12 });
+        expect(largest['randomString'](1000, (bytes: Uint8Array) => bytes.fill(255))).toBe(alphabetOfSize(256)[255].repeat(1000));
+
+        const boundary = new SortableIDGenerator({ alphabet: alphabetOfSize(255), totalLength: 12 });
+        const drawn = new Set(boundary['randomString'](20000, (bytes: Uint8Array) => { crypto.getRandomValues(bytes); }));
+        expect(drawn.size).toBe(255);
+
+        expect(() => new SortableIDGenerator({ alphabet: alphabetOfSize(257), totalLength: 12 }))
+            .toThrow('Random alphabet has 257 characters, more than the 256 a random byte can select from');
+        expect(new SortableIDGenerator({ alphabet: alphabetOfSize(257), totalLength: 12, randomCharExclude: alphabetOfSize(257)[0] })).toBeDefined();
+    });
+
+    it('should generate strictly increasing IDs from an external sequence', () => {
+        let now = new Date('2024-03-05T10:20:30Z');
+        const generator = new SortableIDGenerator({
+            alphabet: ALPHABET_HEX,
+            totalLength: 16,
+            timestampLevel: 'second',
+            maxSortableRate: MaxSortableRate.Second100,
+            clock: () => now
+        });
+
+        const ids: string[] = [];
+        for (let seq = 0; seq < 600; seq++) {
+            if (seq === 300) {
+                now = new Date('2024-03-05T10:20:31Z');
+            }
+            ids.push(generator.generateFromSequence(seq));
+        }
+        for (let i = 1; i < ids.length; i++) {
+            expect(ids[i] > ids[i - 1]).toBe(true);
+        }
+        expect(ids[255].slice(-7)).toBe('00000ff');
+        expect(generator.decode(ids[0]).timestamp).toEqual(new Date('2024-03-05T10:20:30Z'));
+
+        // 9 timestamp symbols leave 7 hex symbols for the sequence
+        expect(() => generator.generateFromSequence(Math.pow(16, 7) - 1)).not.toThrow();
+        expect(() => generator.generateFromSequence(Math.pow(16, 7))).toThrow('Sequence number must be an integer between 0 and 268435455');
+        expect(() => generator.generateFromSequence(-1)).toThrow('Sequence number must be an integer');
+    });
+
+    it('should rank IDs within their time unit', () => {
+        const now = new Date('2024-03-05T10:20:30Z');
+        const generator = new SortableIDGenerator({ timestampLevel: 'second', maxSortableRate: MaxSortableRate.Second100, clock: () => now });
+        const ids = Array.from({ length: 100 }, () => generator.generate());
+        ids.forEach((id, i) => expect(generator.rankInUnit(id)).toBe(i));
+
+        // Past the chrono capacity the chrono part stops counting, so the rank is a lower bound
+        const binary = new SortableIDGenerator({
+            alphabet: '01',
+            totalLength: 60,
+            timestampLevel: 'second',
+            maxSortableRate: MaxSortableRate.Second1,
+            counterInRandom: true,
+            clock: () => now
+        });
+        const ranks = Array.from({ length: 5 }, () => binary.rankInUnit(binary.generate()));
+        expect(ranks).toEqual([0, 1, 1, 1, 1]);
+    });
+
+    it('should return timestamp prefixes that sort consistently with full IDs', () => {
+        let now = new Date('2024-03-05T10:20:30.250Z');
+        const generator = new SortableIDGenerator({ timestampLevel: 'second', version: 1, clock: () => now });
+
+        const id = generator.generate();
+        const prefix = generator.timestampPrefix(now);
+        expect(id.startsWith(prefix)).toBe(true);
+        expect(prefix.length).toBe(1 + generator['timestampLength']);
+        expect(generator.timestampPrefix(new Date('2024-03-05T10:20:30.999Z'))).toBe(prefix);
+
+        const nextPrefix = generator.timestampPrefix(new Date('2024-03-05T10:20:31Z'));
+        now = new Date('2024-03-05T10:20:31.500Z');
+        const later = generator.generate();
+        expect(prefix <= id && id < nextPrefix).toBe(true);
+        expect(nextPrefix <= later).toBe(true);
+
+        expect(() => generator.timestampPrefix(new Date(2023, 0, 1))).toThrow('Date is before minimum supported timestamp');
+        expect(() => generator.timestampPrefix(new Date(2300, 0, 1))).toThrow('Date exceeds maximum supported timestamp');
+        expect(() => generator.timestampPrefix(new Date(NaN))).toThrow('Date must be a valid date');
+    });
+
+    it('should return half-open bounds containing every ID generated in a time range', () => {
+        let now = new Date('2024-03-05T10:00:00Z');
+        const generator = new SortableIDGenerator({ timestampLevel: 'minute', clock: () => now });
+        const start = new Date('2024-03-05T10:05:00Z');
+        const end = new Date('2024-03-05T10:10:30Z');
+        const { lower, upper } = generator.rangeBounds(start, end);
+        expect(lower.length).toBe(32);
+        expect(upper.length).toBe(32);
+
+        const inside: string[] = [];
+        const outside: string[] = [];
+        for (let minute = 0; minute < 15; minute++) {
+            now = new Date(Date.UTC(2024, 2, 5, 10, minute, 30));
+            const id = generator.generate();
+            (minute >= 5 && minute <= 10 ? inside : outside).push(id);
+        }
+        inside.forEach(id => expect(lower <= id && id < upper).toBe(true));
+        outside.forEach(id => expect(lower <= id && id < upper).toBe(false));
+
+        expect(() => generator.rangeBounds(end, start)).toThrow('Range end must not be before range start');
+        expect(() => generator.rangeBounds(start, new Date(2300, 0, 1))).toThrow('Date exceeds maximum supported timestamp');
+    });
+
+    it('should transcode IDs between alphabets keeping their timestamps and order', () => {
+        let now = new Date('2024-03-05T10:20:30.456Z');
+        const base62 = new SortableIDGenerator({ alphabet: ALPHABET_BASE62, clock: () => now });
+        const base64 = new SortableIDGenerator({ clock: () => now });
+
+        const ids: string[] = [];
+        for (let i = 0; i < 20; i++) {
+            now = new Date(now.getTime() + (i % 3));
+            ids.push(base62.generate());
+        }
+        const transcoded = ids.map(id => SortableIDGenerator.transcodeID(base62, base64, id));
+        transcoded.forEach((id, i) => {
+            expect(base64.decode(id).timestamp).toEqual(base62.decode(ids[i]).timestamp);
+            expect(SortableIDGenerator.transcodeID(base64, base62, id)).toBe(ids[i]);
+        });
+        expect([...transcoded].sort()).toEqual(transcoded);
+        const debugId = base62.generateDebug();
+        expect(SortableIDGenerator.transcodeID(base62, base64, debugId))
+            .toBe(SortableIDGenerator.transcodeID(base62, base64, debugId.split('#')[0]));
+
+        const hourly = new SortableIDGenerator({ timestampLevel: 'hour', clock: () => now });
+        expect(() => SortableIDGenerator.transcodeID(base62, hourly, ids[0]))
+            .toThrow('Generators must share timestampLevel and timestampStart to transcode IDs');
+        const short = new SortableIDGenerator({ totalLength: 12, maxSortableRate: MaxSortableRate.Milli10, clock: () => now });
+        expect(() => SortableIDGenerator.transcodeID(base62, short, ids[0])).toThrow("ID machine ID part does not fit in the target generator's");
+    });
+
+    it('should cap the chrono length and give the space to the machine ID part', () => {
+        const derived = new SortableIDGenerator({ maxSortableRate: MaxSortableRate.Micro100 });
+        const capped = new SortableIDGenerator({ maxSortableRate: MaxSortableRate.Micro100, maxChronoLength: 2 });
+
+        const info = capped.printInfo();
+        expect(derived['chronoLength']).toBe(3);
+        expect(info.chronoLength).toBe(2);
+        expect(info.derivedChronoLength).toBe(3);
+        expect(capped['machineIdLength']).toBe(derived['machineIdLength'] + 1);
+        expect(capped.decode(capped.generate()).chronoPart.length).toBe(2);
+
+        // A cap above the derived length changes nothing
+        expect(new SortableIDGenerator({ maxSortableRate: MaxSortableRate.Micro100, maxChronoLength: 5 })['chronoLength']).toBe(3);
+        expect(() => new SortableIDGenerator({ maxChronoLength: 0 })).toThrow('maxChronoLength must be a positive integer');
+    });
+
+    it('should check that a list of IDs is valid and sorted', () => {
+        const generator = new SortableIDGenerator();
+        const ids = Array.from({ length: 10 }, () => generator.generate());
+
+        expect(generator.isSorted(ids)).toBe(true);
+        expect(generator.isSorted([])).toBe(true);
+        expect(() => generator.assertSorted(ids)).not.toThrow();
+
+        const unsorted = [...ids];
+        [unsorted[6], unsorted[7]] = [unsorted[7], unsorted[6]];
+        expect(generator.isSorted(unsorted)).toBe(false);
+        expect(() => generator.assertSorted(unsorted)).toThrow('IDs at index 6 and 7 are out of order');
+
+        const invalid = [...ids.slice(0, 3), 'bogus'];
+        expect(generator.isSorted(invalid)).toBe(false);
+        expect(() => generator.assertSorted(invalid)).toThrow('Invalid ID at index 3: ID must be exactly 32 characters long');
+    });
+
+    it('should create fixed-width numeric IDs', () => {
+        const generator = SortableIDGenerator.numeric(20);
+        for (let i = 0; i < 100; i++) {
+            expect(generator.generate()).toMatch(/^[0-9]{20}$/);
+        }
+
+        const daily = SortableIDGenerator.numeric(12, new Date(2024, 0, 1), 'day', MaxSortableRate.Second1);
+        const id = daily.generate();
+        expect(id).toMatch(/^[0-9]{12}$/);
+        expect((daily.decode(id).timestamp.getTime() - new Date(2024, 0, 1).getTime()) % 86_400_000).toBe(0);
+
+        expect(() => SortableIDGenerator.numeric(0)).toThrow('Numeric ID length must be a positive integer');
+        expect(() => SortableIDGenerator.numeric(10)).toThrow('Total length must be at least 18');
+    });
+
+    it('should never start IDs with characters in avoidLeadingChars', () => {
+        const now = new Date(2024, 0, 1, 0, 0, 1);
+        const plain = new SortableIDGenerator({ clock: () => now });
+        expect(plain.generate()[0]).toBe('-');
+
+        const generator = new SortableIDGenerator({ avoidLeadingChars: '-0', clock: () => now });
+        const early = generator.generate();
+        expect(early[0]).toBe('1');
+        expect(generator.decode(early).timestamp).toEqual(now);
+        generator.sample(200).forEach(id => expect('-0'.includes(id[0])).toBe(false));
+        expect(generator.getMaxDate()).toEqual(plain.getMaxDate());
+
+        // Order is unchanged
+        const ids = generator.sample(100).sort();
+        const timestamps = ids.map(id => generator.decode(id).timestamp.getTime());
+        expect([...timestamps].sort((a, b) => a - b)).toEqual(timestamps);
+
+        // Avoiding a character in the middle of the alphabet can require a longer timestamp
+        const decimal = new SortableIDGenerator({
+            alphabet: '0123456789',
+            timestampLevel: 'day',
+            timestampEnd: new Date(2024, 0, 1 + 500),
+            maxSortableRate: MaxSortableRate.Day1,
+            totalLength: 8,
+            avoidLeadingChars: '05',
+            clock: () => now
+        });
+        expect(decimal['timestampLength']).toBe(4);
+        expect(decimal.generate()[0]).toBe('1');
+
+        expect(() => new SortableIDGenerator({ avoidLeadingChars: '*' })).toThrow('avoidLeadingChars must only contain alphabet characters');
+    });
+
+    it('should derive stable, verifiable short codes from IDs', () => {
+        const generator = new SortableIDGenerator();
+        const { id, shortCode } = generator.generateWithShortCode(8);
+
+        expect(shortCode).toMatch(/^[0-9A-HJKMNP-TV-Z]{8}$/);
+        expect(generator.verifyShortCode(id, shortCode)).toBe(true);
+        expect(generator.verifyShortCode(id, shortCode.toLowerCase())).toBe(true);
+        expect(generator['shortCode'](id, 8)).toBe(shortCode);
+
+        // Any single changed character is detected
+        for (let i = 0; i < shortCode.length; i++) {
+            const replacement = shortCode[i] === '0' ? '1' : '0';
+            const tampered = shortCode.slice(0, i) + replacement + shortCode.slice(i + 1);
+            expect(generator.verifyShortCode(id, tampered)).toBe(false);
+        }
+        expect(generator.verifyShortCode(generator.generate(), shortCode)).toBe(false);
+
+        const codes = new Set(Array.from({ length: 1000 }, () => generator.generateWithShortCode(10).shortCode));
+        expect(codes.size).toBe(1000);
+        expect(() => generator.generateWithShortCode(1)).toThrow('Short code length must be an integer between 2 and 13');
+    });
+
+    it('should use defaultLifespan when timestampEnd is not set', () => {
+        const fiftyYears = 50 * 365.25 * 24 * 60 * 60 * 1000;
+        const builtin = new SortableIDGenerator({ alphabet: ALPHABET_HEX, timestampLevel: 'second' });
+        const short = new SortableIDGenerator({ alphabet: ALPHABET_HEX, timestampLevel: 'second', defaultLifespan: fiftyYears });
+
+        expect(short['timestampLength']).toBeLessThan(builtin['timestampLength']);
+        expect(short['machineIdLength']).toBeGreaterThan(builtin['machineIdLength']);
+        expect(Math.abs(short.getMaxDate().getTime() - (new Date(2024, 0, 1).getTime() + fiftyYears))).toBeLessThan(1);
+
+        // An explicit timestampEnd wins
+        const explicit = new SortableIDGenerator({ timestampEnd: new Date(2224, 0, 1), defaultLifespan: fiftyYears });
+        expect(explicit.getMaxDate()).toEqual(new SortableIDGenerator().getMaxDate());
+        expect(() => new SortableIDGenerator({ defaultLifespan: 0 })).toThrow('defaultLifespan must be a positive number of milliseconds');
+    });
+
+    it('should decode IDs into numeric components that recompose the ID', () => {
+        const generator = new SortableIDGenerator({ timestampLevel: 'second', version: 3 });
+        const encode = (value: bigint, length: number) => {
+            const alphabet: string = generator['alphabet'];
+            let result = '';
+            for (let i = 0; i < length; i++) {
+                result = alphabet[Number(value % BigInt(64))] + result;
+                value /= BigInt(64);
+            }
+            return result;
+        };
+
+        for (let i = 0; i < 20; i++) {
+            const id = generator.generate();
+            const { timestampValue, chronoValue, randomValue } = generator.decodeComponents(id);
+            expect(typeof randomValue).toBe('bigint');
+            const rebuilt = generator['versionPrefix'] + generator['encodeTimestamp'](timestampValue) +
+                encode(BigInt(chronoValue), generator['chronoLength']) + encode(randomValue, generator['machineIdLength']);
+            expect(rebuilt).toBe(id);
+            expect(new Date(new Date(2024, 0, 1).getTime() + timestampValue * 1000)).toEqual(generator.decode(id).timestamp);
+        }
+    });
+
+    it('should report the next chrono slot without generating', () => {
+        let now = new Date('2024-03-05T10:20:30Z');
+        const generator = new SortableIDGenerator({
+            alphabet: '0123',
+            totalLength: 40,
+            timestampLevel: 'second',
+            maxSortableRate: MaxSortableRate.Second1,
+            clock: () => now
+        });
+        expect(generator.nextChronoSlot()).toEqual({ slot: 0, exhausted: false });
+
+        generator.generate();
+        expect(generator.nextChronoSlot()).toEqual({ slot: 1, exhausted: false });
+        expect(generator.nextChronoSlot()).toEqual({ slot: 1, exhausted: false });
+        generator.generate();
+        generator.generate();
+        expect(generator.nextChronoSlot()).toEqual({ slot: 3, exhausted: false });
+        generator.generate();
+        expect(generator.nextChronoSlot()).toEqual({ slot: 4, exhausted: true });
+
+        now = new Date('2024-03-05T10:20:31Z');
+        expect(generator.nextChronoSlot()).toEqual({ slot: 0, exhausted: false });
+    });
+
+    it('should promote to a finer level after repeated chrono overflows', () => {
+        let now = new Date('2024-03-05T10:20:30Z');
+        const promotions: any[] = [];
+        const generator = new SortableIDGenerator({
+            timestampLevel: 'second',
+            maxSortableRate: MaxSortableRate.Second1,
+            version: 0,
+            counterInRandom: true,
+            autoPromoteLevel: true,
+            onLevelPromoted: config => promotions.push(config),
+            clock: () => now
+        });
+        const ids: string[] = [];
+
+        // Overflow the 64 chrono slots in three seconds
+        for (let second = 0; second < 3; second++) {
+            now = new Date(Date.UTC(2024, 2, 5, 10, 20, 30 + second));
+            for (let i = 0; i < 70; i++) {
+                ids.push(generator.generate());
+            }
+        }
+        expect(promotions.length).toBe(0);
+
+        // Promotion waits for the next time unit; peek shows the promoted ID without promoting
+        now = new Date('2024-03-05T10:20:33.500Z');
+        const peeked = generator.peek();
+        expect(generator.peek()).toBe(peeked);
+        expect(promotions.length).toBe(0);
+        ids.push(generator.generate());
+        expect(ids[ids.length - 1]).toBe(peeked);
+        expect(promotions.length).toBe(1);
+        expect(promotions[0].timestampLevel).toBe('millisecond');
+        expect(promotions[0].version).toBe(1);
+        expect(ids[ids.length - 1][0]).toBe(generator['alphabet'][1]);
+
+        now = new Date('2024-03-05T10:20:33.501Z');
+        ids.push(generator.generate());
+        expect([...ids].sort()).toEqual(ids);
+        expect(new Set(ids).size).toBe(ids.length);
+        expect(generator.decode(ids[ids.length - 1]).timestamp).toEqual(now);
+        expect(new SortableIDGenerator(promotions[0]).equal(generator)).toBe(true);
+
+        expect(() => new SortableIDGenerator({ autoPromoteLevel: true }))
+            .toThrow('autoPromoteLevel requires a version, so promoted IDs can sort after earlier ones');
+    });
+
+    it('should stay at its level when the promoted layout does not fit', () => {
+        let now = new Date('2024-03-05T10:20:30Z');
+        const promotions: any[] = [];
+        const config = {
+            timestampLevel: 'second' as const,
+            maxSortableRate: MaxSortableRate.Second1,
+            version: 0,
+            counterInRandom: true,
+            autoPromoteLevel: true,
+            // Fits a second-level timestamp, but not a millisecond-level one
+            totalLength: 10,
+            onLevelPromoted: (promoted: any) => promotions.push(promoted),
+            clock: () => now
+        };
+        const generator = new SortableIDGenerator(config);
+        const ids: string[] = [];
+        for (let second = 0; second < 4; second++) {
+            now = new Date(Date.UTC(2024, 2, 5, 10, 20, 30 + second));
+            for (let i = 0; i < 70; i++) {
+                ids.push(generator.generate());
+            }
+        }
+
+        expect(promotions.length).toBe(0);
+        expect(generator.config().timestampLevel).toBe('second');
+        expect(generator.equal(new SortableIDGenerator(config))).toBe(true);
+        expect(generator.isSorted(ids)).toBe(true);
+        expect(new Set(ids).size).toBe(ids.length);
+    });
+
+    it('should verify IDs against a stored config', () => {
+        const config = { alphabet: ALPHABET_HEX, totalLength: 24, timestampLevel: 'second' as TimestampLevel, version: 1 };
+        const id = new SortableIDGenerator(config).generate();
+        expect(() => verifyID(id, config)).not.toThrow();
+
+        // Wrong config
+        expect(() => verifyID(id, { ...config, version: 2 })).toThrow('ID version 1 does not match generator version 2');
+        expect(() => verifyID(id, { ...config, totalLength: 25 })).toThrow('ID must be exactly 25 characters long');
+
+        // Corrupted IDs
+        expect(() => verifyID(id.slice(0, -1) + 'x', config)).toThrow('ID contains invalid characters');
+        expect(() => verifyID('1' + 'f'.repeat(23), config)).toThrow('ID timestamp is outside the range of the configuration');
+        expect(() => verifyID(id, { ...config, alphabet: 'a' })).toThrow('Alphabet must contain at least 2 characters');
+
+        // Archived configs whose range has ended still verify their IDs
+        const expired = { ...config, timestampStart: new Date('2020-01-01T00:00:00Z'), timestampEnd: new Date('2021-01-01T00:00:00Z') };
+        expect(() => new SortableIDGenerator(expired)).toThrow('Max date is in the past');
+        const archivedId = new SortableIDGenerator({ ...expired, clock: () => new Date('2020-06-01T00:00:00Z') }).generate();
+        expect(() => verifyID(archivedId, expired)).not.toThrow();
+        expect(() => verifyID(archivedId, { ...expired, blocklist: [archivedId.slice(1, 4)] })).not.toThrow();
+    });
+
+    it('should map IDs in the same bucket to the same bucket key', () => {
+        let now = new Date('2024-03-05T10:00:00Z');
+        const generator = new SortableIDGenerator({ timestampStart: new Date('2024-01-01T00:00:00Z'), clock: () => now });
+
+        const keysByHour = new Map<number, Set<string>>();
+        for (let minute = 0; minute < 180; minute += 7) {
+            now = new Date(Date.UTC(2024, 2, 5, 10, minute, minute % 60, minute));
+            const key = generator.bucketKey(generator.generate(), 'hour');
+            const hour = Math.floor(minute / 60);
+            keysByHour.set(hour, (keysByHour.get(hour) || new Set()).add(key));
+        }
+        const keys = [0, 1, 2].map(hour => [...(keysByHour.get(hour) as Set<string>)]);
+        keys.forEach(hourKeys => expect(hourKeys.length).toBe(1));
+        expect(keys[0][0] < keys[1][0] && keys[1][0] < keys[2][0]).toBe(true);
+        // 200 years of hours (about 1.75 million) take 4 base-64 symbols
+        expect(keys[0][0].length).toBe(4);
+
+        expect(generator.bucketKey(generator.generate(), 'millisecond').length).toBe(generator['timestampLength']);
+        const monthly = generator.bucketKey(generator.generate(), 'month');
+        now = new Date(Date.UTC(2024, 2, 31, 12));
+        expect(generator.bucketKey(generator.generate(), 'month')).toBe(monthly);
+
+        // Keys are shifted past avoidLeadingChars like timestamps are
+        const avoiding = new SortableIDGenerator({ avoidLeadingChars: '-', clock: () => now });
+        const id = avoiding.generate();
+        expect(avoiding.bucketKey(id, 'hour')[0]).not.toBe('-');
+        expect(avoiding.bucketKey(id, 'millisecond')).toBe(id.slice(0, avoiding['timestampLength']));
+
+        const hourly = new SortableIDGenerator({ timestampLevel: 'hour' });
+        expect(() => hourly.bucketKey(hourly.generate(), 'minute')).toThrow('Bucket level must not be finer than timestampLevel (hour)');
+    });
+
+    it('should generate IDs with distinct timestamps', async () => {
+        let ms = new Date('2024-03-05T10:20:30Z').getTime();
+        // Each clock reading advances 300 ms, so several readings share a second
+        const generator = new SortableIDGenerator({ timestampLevel: 'second', clock: () => new Date(ms += 300) });
+
+        const ids = await generator.generateDistinctTimestamps(5);
+        const prefixes = ids.map(id => id.slice(0, generator['timestampLength']));
+        expect(new Set(prefixes).size).toBe(5);
+        expect([...ids].sort()).toEqual(ids);
+        expect(await generator.generateDistinctTimestamps(0)).toEqual([]);
+
+        // Waits on the real clock
+        const realTime = new SortableIDGenerator({ timestampLevel: 'millisecond' });
+        const realIds = await realTime.generateDistinctTimestamps(3);
+        expect(new Set(realIds.map(id => realTime.decode(id).timestamp.getTime())).size).toBe(3);
+
+        // A clock that never advances can't produce a second unit
+        const frozen = new SortableIDGenerator({ clock: () => new Date('2024-03-05T10:20:30Z') });
+        await expect(frozen.generateDistinctTimestamps(2, 20)).rejects.toThrow('Could not reach 2 distinct time units within 20 ms');
+    });
+
+    it('should compare IDs within the clock skew tolerance as equal', () => {
+        let now = new Date('2024-03-05T10:20:30.000Z');
+        const generator = new SortableIDGenerator({ clockSkewTolerance: 50, clock: () => now });
+        const first = generator.generate();
+        now = new Date('2024-03-05T10:20:30.040Z');
+        const withinSkew = generator.generate();
+        now = new Date('2024-03-05T10:20:30.100Z');
+        const later = generator.generate();
+
+        expect(generator.compareWithSkew(first, withinSkew)).toBe(0);
+        expect(generator.compareWithSkew(withinSkew, first)).toBe(0);
+        expect(generator.compareWithSkew(first, later)).toBe(-1);
+        expect(generator.compareWithSkew(later, first)).toBe(1);
+        expect(new SortableIDGenerator({ clock: () => now }).compareWithSkew(first, withinSkew)).toBe(-1);
+        expect(() => new SortableIDGenerator({ clockSkewTolerance: -1 })).toThrow('clockSkewTolerance must be a non-negative number of milliseconds');
+    });
+
+    it('should only accept the smallest alphabet character as padChar', () => {
+        const generator = new SortableIDGenerator({ alphabet: 'zyxwvutsrqponmlkjihgfedcba', padChar: 'a', totalLength: 30 });
+        expect(generator['encodeTimestamp'](1).startsWith('a'.repeat(generator['timestampLength'] - 1))).toBe(true);
+        expect(generator.generate().length).toBe(30);
+
+        expect(() => new SortableIDGenerator({ alphabet: 'zyxwvutsrqponmlkjihgfedcba', padChar: 'z' }))
+            .toThrow("padChar 'z' must be the smallest alphabet character ('a') to preserve sort order");
+        expect(() => new SortableIDGenerator({ padChar: '0' })).toThrow("padChar '0' must be the smallest alphabet character ('-')");
+        expect(() => new SortableIDGenerator({ padChar: '--' })).toThrow('padChar');
+    });
+
+    it('should enumerate every ID of a time unit for tiny configs', () => {
+        const now = new Date('2024-03-05T10:20:30Z');
+        const generator = new SortableIDGenerator({
+            alphabet: '0123',
+            totalLength: 14,
+            timestampStart: new Date('2024-01-01T00:00:00Z'),
+            timestampLevel: 'day',
+            maxSortableRate: MaxSortableRate.Day1,
+            clock: () => now
+        });
+        const ids = [...generator.enumerateUnit(now)];
+
+        expect(generator.capacity()).toBe(Math.pow(4, 14 - generator['timestampLength']));
+        expect(ids.length).toBe(generator.capacity());
+        expect(new Set(ids).size).toBe(ids.length);
+        expect([...ids].sort()).toEqual(ids);
+        ids.forEach(id => expect(generator.decode(id).timestamp).toEqual(new Date('2024-03-05T00:00:00Z')));
+        const generated = generator.generate();
+        expect(ids.includes(generated)).toBe(true);
+
+        expect(() => new SortableIDGenerator({ clock: () => now }).enumerateUnit(now)).toThrow('too many to enumerate');
+    });
+
+    it('should never return blocklisted IDs', () => {
+        let now = new Date('2024-03-05T10:20:30Z');
+        const generator = new SortableIDGenerator({
+            alphabet: '0123456789',
+            totalLength: 24,
+            timestampStart: new Date('2024-01-01T00:00:00Z'),  // No blocked digits in the timestamps used here
+            timestampLevel: 'second',
+            maxSortableRate: MaxSortableRate.Second100,
+            blocklist: ['7', '99'],
+            clock: () => now
+        });
+        const ids: string[] = [];
+        for (let i = 0; i < 200; i++) {
+            if (i % 50 === 0) {
+                now = new Date(now.getTime() + 1000);
+            }
+            ids.push(generator.generate());
+        }
+        ids.forEach(id => expect(id.includes('7') || id.includes('99')).toBe(false));
+        expect([...ids].sort()).toEqual(ids);
+        expect(new Set(ids).size).toBe(ids.length);
+
+        let blockAll = true;
+        const blocked = new SortableIDGenerator({ blocklistFunc: () => blockAll, clock: () => now });
+        expect(() => blocked.generate()).toThrow('Could not generate an ID outside the blocklist in 100 attempts');
+        // The failed call used up no chrono values
+        blockAll = false;
+        expect(blocked.rankInUnit(blocked.generate())).toBe(0);
+        expect(() => new SortableIDGenerator({ blocklist: [''] })).toThrow('Blocklist entries must be non-empty strings');
+
+        // '-' pads the start of every default timestamp, so nothing could be generated
+        expect(() => new SortableIDGenerator({ blocklist: ['-'], clock: () => now })).toThrow("Blocklist entry '-' matches every ID");
+
+        // Changing the caller's array afterwards doesn't change the generator
+        const entries = ['zz'];
+        const copied = new SortableIDGenerator({ blocklist: entries, clock: () => now });
+        entries.push('');
+        expect(copied.generate()).toHaveLength(32);
+    });
+
+    it('should peek at the ID generate() returns when the next candidate is blocklisted', () => {
+        const now = new Date('2024-03-05T10:20:30Z');
+        let draws = 0;
+        const generator = new SortableIDGenerator({
+            alphabet: ALPHABET_HEX,
+            totalLength: 24,
+            timestampLevel: 'second',
+            maxSortableRate: MaxSortableRate.Second100,
+            // The first random part drawn is blocklisted, the reroll isn't
+            randomFunc: length => (draws++ === 0 ? 'f' : '1').repeat(length),
+            blocklist: ['f'.repeat(13)],
+            clock: () => now
+        });
+
+        const peeked = generator.peek();
+        expect(peeked.endsWith('1'.repeat(13))).toBe(true);
+        expect(generator.peek()).toBe(peeked);
+        expect(generator.generate()).toBe(peeked);
+        // generate() reused the random parts peek() drew
+        expect(draws).toBe(2);
+    });
+
+    it('should decode IDs into consistent event records', () => {
+        const now = new Date('2024-03-05T10:20:30.456Z');
+        const generator = new SortableIDGenerator({ clock: () => now });
+        const ids = Array.from({ length: 3 }, () => generator.generate());
+
+        ids.forEach((id, i) => {
+            const event = generator.decodeEvent(id);
+            expect(event.valid).toBe(true);
+            expect(event.timestamp).toEqual(generator.decode(id).timestamp);
+            expect(event.unixNanos).toBe(BigInt(now.getTime()) * BigInt(1_000_000));
+            expect(event.sequenceInUnit).toBe(i);
+            expect(event.sequenceInUnit).toBe(generator.rankInUnit(id));
+        });
+
+        const invalid = generator.decodeEvent('not an id');
+        expect(invalid.valid).toBe(false);
+        expect(isNaN(invalid.timestamp.getTime())).toBe(true);
+    });
+
+    it('should reproduce the recorded cross-implementation vectors', () => {
+        const { vectors } = JSON.parse(readFileSync('tests/vectors.json', 'utf8'));
+        const randomFunc = (length: number, alphabet: string) => Array.from({ length }, (_, i) => alphabet[i % alphabet.length]).join('');
+
+        expect(vectors.length).toBeGreaterThan(0);
+        for (const vector of vectors) {
+            let now = new Date(vector.times[0]);
+            const generator = new SortableIDGenerator({
+                ...vector.config,
+                timestampStart: new Date(vector.config.timestampStart),
+                clock: () => now,
+                randomFunc
+            });
+            const ids = vector.times.map((time: string) => {
+                now = new Date(time);
+                return generator.generate();
+            });
+            expect(ids).toEqual(vector.ids);
+        }
+    });
+
+    it('should always generate IDs of exactly totalLength for random configs', () => {
+        // Small deterministic PRNG (mulberry32) so failures are reproducible
+        let seed = 0x5eed;
+        const random = () => {
+            seed = (seed + 0x6d2b79f5) | 0;
+            let t = Math.imul(seed ^ (seed >>> 15), 1 | seed);
+            t = (t + Math.imul(t ^ (t >>> 7), 61 | t)) ^ t;
+            return ((t ^ (t >>> 14)) >>> 0) / 4294967296;
+        };
+        const pick = <T>(values: T[]): T => values[Math.floor(random() * values.length)];
+        const levels: TimestampLevel[] = ['millisecond', 'second', 'minute', 'hour', 'day', 'month', 'year'];
+        const rates = [...Object.values(MaxSortableRate), 3, 7.5, 1000, 123456];
+        const chars = '!#$%&()*+,-.0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[]^_abcdefghijklmnopqrstuvwxyz{|}~éü€';
+
+        let checked = 0;
+        for (let i = 0; i < 300; i++) {
+            const size = 2 + Math.floor(random() * (chars.length - 2));
+            const alphabet = [...chars].sort(() => random() - 0.5).slice(0, size).join('');
+            const config = {
+                alphabet,
+                totalLength: 4 + Math.floor(random() * 60),
+                timestampLevel: pick(levels),
+                maxSortableRate: pick(rates),
+                counterInRandom: random() < 0.2,
+                poolRefillJitter: random() < 0.2,
+                signedEpoch: random() < 0.2,
+                allowZeroRandom: random() < 0.2,
+                version: random() < 0.2 ? 0 : undefined,
+                randomCharExclude: random() < 0.2 ? alphabet.slice(0, 2) : undefined
+            };
+
+            let generator: SortableIDGenerator;
+            try {
+                generator = new SortableIDGenerator(config);
+            } catch {
+                continue;  // Too short for this alphabet, level and rate
+            }
+            for (let j = 0; j < 20; j++) {
+                let id: string;
+                try {
+                    id = generator.generate();
+                } catch (error: any) {
+                    // Tiny chrono and machine ID parts can legitimately run out within one time unit
+                    expect(error.message).toMatch('Generation rate exceeded');
+                    break;
+                }
+                expect(id.length).toBe(config.totalLength);
+                expect(generator.decode(id).machineId.length).toBe(generator['machineIdLength']);
+                generator.verifyRoundTrip(id);
+            }
+            checked++;
+        }
+        expect(checked).toBeGreaterThan(100);
+    });
+
+    it('should reserve chrono blocks that later generation does not reuse', () => {
+        const now = new Date('2024-03-05T10:20:30Z');
+        const generator = new SortableIDGenerator({
+            timestampLevel: 'second',
+            maxSortableRate: MaxSortableRate.Second1,
+            clock: () => now
+        });
+        const before = generator.generate();
+
+        const { startId, endId } = generator.reserveBlock(now, 10);
+        expect(startId > before).toBe(true);
+        expect(endId > startId).toBe(true);
+        expect(generator.decode(startId).timestamp).toEqual(now);
+        expect(generator.rankInUnit(startId)).toBe(1);
+
+        const after: string[] = [];
+        for (let i = 0; i < 5; i++) {
+            after.push(generator.generate());
+        }
+        for (const id of after) {
+            expect(id > endId).toBe(true);
+        }
+        expect(generator.isSorted([before, startId, endId, ...after])).toBe(true);
+
+        // 64 slots: 1 + 10 + 5 used
+        expect(() => generator.reserveBlock(now, 49)).toThrow('does not fit');
+        expect(() => generator.reserveBlock(new Date('2024-03-05T10:20:29Z'), 1)).toThrow('before the last generated');
+        expect(() => generator.reserveBlock(now, 0)).toThrow('positive integer');
+        generator.reserveBlock(now, 48);
+        expect(generator.nextChronoSlot().exhausted).toBe(true);
+        // The block took the last slot, so generation can't continue inside it through the machine ID part
+        expect(() => generator.generate()).toThrow('Generation rate exceeded');
+    });
+
+    it('should not reserve blocks in future time units', () => {
+        let now = new Date('2024-03-05T10:20:30Z');
+        const next = new Date('2024-03-05T10:20:31Z');
+        const generator = new SortableIDGenerator({
+            timestampLevel: 'second',
+            maxSortableRate: MaxSortableRate.Second1,
+            clock: () => now
+        });
+
+        // Generating in the current unit would forget a block reserved for the next one
+        expect(() => generator.reserveBlock(next, 10)).toThrow('after the current one');
+        generator.generate();
+
+        now = next;
+        const { startId, endId } = generator.reserveBlock(next, 10);
+        const second = generator.reserveBlock(next, 5);
+        const after = [generator.generate(), generator.generate()];
+        expect(second.startId > endId).toBe(true);
+        for (const id of after) {
+            expect(id > second.endId).toBe(true);
+        }
+        expect(generator.rankInUnit(startId)).toBe(0);
+        expect(generator.rankInUnit(second.startId)).toBe(10);
+        expect(generator.rankInUnit(after[0])).toBe(15);
+    });
+
+    it('should embed the process ID so processes on one host do not collide', () => {
+        const now = new Date('2024-03-05T10:20:30Z');
+        const config = {
+            timestampLevel: 'second' as const,
+            maxSortableRate: MaxSortableRate.Second1,
+            embedPid: true,
+            randomFunc: (length: number, alphabet: string) => alphabet[0].repeat(length),  // Identical random parts
+            clock: () => now
+        };
+        const first = new SortableIDGenerator({ ...config, pid: 4242 });
+        const second = new SortableIDGenerator({ ...config, pid: 4243 });
+
+        const firstIds = Array.from({ length: 20 }, () => first.generate());
+        const secondIds = Array.from({ length: 20 }, () => second.generate());
+        expect(new Set([...firstIds, ...secondIds]).size).toBe(40);
+        expect(first.decode(firstIds[0]).pid).toBe(4242);
+        expect(second.decode(secondIds[0]).pid).toBe(4243);
+        expect(first.decode(firstIds[0]).nodeId).toBeUndefined();
+
+        const wrapped = new SortableIDGenerator({ ...config, pid: PID_SPACE + 4242 });
+        expect(wrapped.decode(wrapped.generate()).pid).toBe(4242);
+        const own = new SortableIDGenerator({ embedPid: true });
+        expect(own.decode(own.generate()).pid).toBe(process.pid % PID_SPACE);
+        expect(() => new SortableIDGenerator({ embedPid: true, clusterSize: 4, nodeId: 1 })).toThrow('embedPid cannot be combined with clusterSize');
+        expect(() => new SortableIDGenerator({ embedPid: true, pid: -1 })).toThrow('Process ID must be a non-negative integer');
+    });
+
+    it('should tell whether a time round-trips exactly', () => {
+        const timestampStart = new Date(2024, 0, 1);
+        const second = new SortableIDGenerator({ timestampStart, timestampLevel: 'second' });
+        expect(second.canRepresentExactly(new Date(2024, 2, 5, 10, 20, 30))).toBe(true);
+        expect(second.canRepresentExactly(new Date(2024, 2, 5, 10, 20, 30, 250))).toBe(false);
+        expect(second.canRepresentExactly(new Date(2023, 11, 31))).toBe(false);  // Before timestampStart
+        expect(second.canRepresentExactly(new Date(NaN))).toBe(false);
+
+        const millisecond = new SortableIDGenerator({ timestampStart, timestampLevel: 'millisecond' });
+        expect(millisecond.canRepresentExactly(new Date(2024, 2, 5, 10, 20, 30, 250))).toBe(true);
+
+        const hour = new SortableIDGenerator({ timestampStart, timestampLevel: 'hour' });
+        expect(hour.canRepresentExactly(new Date(2024, 2, 5, 10))).toBe(true);
+        expect(hour.canRepresentExactly(new Date(2024, 2, 5, 10, 1))).toBe(false);
+
+        const month = new SortableIDGenerator({ timestampStart, timestampLevel: 'month', maxSortableRate: MaxSortableRate.Day1 });
+        expect(month.canRepresentExactly(new Date(2024, 2, 1))).toBe(true);
+        expect(month.canRepresentExactly(new Date(2024, 2, 2))).toBe(false);
+
+        const year = new SortableIDGenerator({ timestampStart, timestampLevel: 'year', maxSortableRate: MaxSortableRate.Day1 });
+        expect(year.canRepresentExactly(new Date(2026, 0, 1))).toBe(true);
+        expect(year.canRepresentExactly(new Date(2026, 1, 1))).toBe(false);
+
+        // Decoding truncated to the hour loses the minutes even though they are encoded
+        const truncated = new SortableIDGenerator({ timestampStart, timestampLevel: 'minute', decodeTruncateTo: 'hour' });
+        expect(truncated.canRepresentExactly(new Date(2024, 2, 5, 10, 20))).toBe(false);
+        expect(truncated.canRepresentExactly(new Date(2024, 2, 5, 10))).toBe(true);
+    });
+
+    it('should group generated IDs and strip separators on decode', () => {
+        let now = new Date('2024-03-05T10:20:30Z');
+        const generator = new SortableIDGenerator({
+            alphabet: ALPHABET_BASE62,
+            totalLength: 16,
+            timestampLevel: 'second',
+            groupEvery: 4,
+            groupSeparator: '-',
+            clock: () => now
+        });
+
+        const ids: string[] = [];
+        for (let i = 0; i < 10; i++) {
+            now = new Date(Date.UTC(2024, 2, 5, 10, 20, 30 + (i >> 1)));
+            ids.push(generator.generate());
+        }
+        for (const id of ids) {
+            expect(id).toMatch(/^[0-9A-Za-z]{4}-[0-9A-Za-z]{4}-[0-9A-Za-z]{4}-[0-9A-Za-z]{4}$/);
+            expect(generator.owns(id)).toBe(true);
+            generator.verifyRoundTrip(id);
+        }
+        expect(generator.decode(ids[9]).timestamp).toEqual(new Date('2024-03-05T10:20:34Z'));
+        expect(generator.decode(ids[9].replace(/-/g, ''))).toEqual(generator.decode(ids[9]));
+        expect([...ids].sort()).toEqual(ids);
+        expect(generator.totalOrder(ids[0], ids[1])).toBe(-1);
+
+        expect(() => new SortableIDGenerator({ groupEvery: 4, groupSeparator: '-' }))
+            .toThrow('groupSeparator must not contain alphabet characters: -');
+        expect(() => new SortableIDGenerator({ groupEvery: 4 })).toThrow('groupSeparator must be a single character');
+        expect(() => new SortableIDGenerator({ groupEvery: 0, groupSeparator: '.' })).toThrow('groupEvery must be a positive integer');
+    });
+
+    it('should decode IDs from several configs by detecting the matching one', () => {
+        const timestampStart = new Date('2024-01-01T00:00:00Z');
+        const configs = [
+            { timestampStart, totalLength: 20 },
+            { timestampStart, totalLength: 24, alphabet: ALPHABET_HEX },
+            { timestampStart, totalLength: 16, timestampLevel: 'second' as const, version: 3 }
+        ];
+        for (const config of configs) {
+            const generator = new SortableIDGenerator(config);
+            const id = generator.generate();
+            const result = decodeAny(configs, id);
+            expect(result.config).toBe(config);
+            expect(result.decoded).toEqual(generator.decode(id));
+        }
+
+        expect(() => decodeAny(configs, 'not an id')).toThrow('ID does not match any of the configurations');
+
+        // Same length and alphabet, different levels: a hex ID fits both
+        const ambiguous = [configs[1], { timestampStart, totalLength: 24, alphabet: ALPHABET_HEX, timestampLevel: 'second' as const }];
+        const id = new SortableIDGenerator(configs[1]).generate();
+        expect(() => decodeAny(ambiguous, id)).toThrow('ID is ambiguous: it matches configurations 0 and 1');
+
+        // Identical layouts are not ambiguous
+        expect(decodeAny([configs[1], { ...configs[1] }], id).config).toBe(configs[1]);
+
+        // A config whose range has ended neither breaks the others nor loses its own IDs
+        const expired = { timestampStart: new Date('2020-01-01T00:00:00Z'), timestampEnd: new Date('2021-01-01T00:00:00Z'), totalLength: 22 };
+        expect(() => new SortableIDGenerator(expired)).toThrow('Max date is in the past');
+        const withExpired = [expired, ...configs, { alphabet: 'a' }];
+        expect(decodeAny(withExpired, id).config).toBe(configs[1]);
+        const archivedAt = new Date('2020-06-01T00:00:00Z');
+        const archivedId = new SortableIDGenerator({ ...expired, clock: () => archivedAt }).generate();
+        const archived = decodeAny(withExpired, archivedId);
+        expect(archived.config).toBe(expired);
+        expect(archived.decoded.timestamp).toEqual(archivedAt);
+    });
+
+    it('should wait for the next time unit when a burst exhausts the current one', async () => {
+        let now = new Date('2024-03-05T10:20:30Z');
+        const generator = new SortableIDGenerator({
+            alphabet: ALPHABET_HEX,
+            totalLength: 12,
+            timestampLevel: 'second',
+            maxSortableRate: MaxSortableRate.Second1,
+            // Second1 needs one chrono symbol: 16 chrono slots, after which the machine ID part would take over.
+            // A maximal machine ID part leaves it no room to.
+            randomFunc: length => 'f'.repeat(length),
+            clock: () => now
+        });
+
+        const first = await generator.generateWithWait();
+        expect(first.waited).toBe(0);
+        for (let i = 1; i < 16; i++) {
+            generator.generate();
+        }
+        expect(() => generator.generate()).toThrow('Generation rate exceeded');
+
+        // The injected clock moves on while the generator waits
+        const timer = setTimeout(() => { now = new Date('2024-03-05T10:20:31Z'); }, 20);
+        const { id, waited } = await generator.generateWithWait();
+        clearTimeout(timer);
+        expect(waited).toBeGreaterThan(0);
+        expect(generator.decode(id).timestamp).toEqual(new Date('2024-03-05T10:20:31Z'));
+
+        now = new Date('2024-03-05T10:20:32Z');
+        for (let i = 0; i < 16; i++) {
+            generator.generate();
+        }
+        await expect(generator.generateWithWait(30)).rejects.toThrow('not reached within 30 ms');
+    });
+
+    it('should shift the encoded timestamp by a per-call epoch offset', () => {
+        let now = new Date('2024-03-05T10:20:30.750Z');
+        const generator = new SortableIDGenerator({
+            timestampStart: new Date('2024-01-01T00:00:00Z'),
+            timestampLevel: 'second',
+            clock: () => now
+        });
+        const hour = 60 * 60 * 1000;
+
+        const ids = [generator.generateWithEpochOffset(-hour), generator.generateWithEpochOffset(-hour)];
+        now = new Date('2024-03-05T10:20:31.100Z');
+        ids.push(generator.generateWithEpochOffset(-hour));
+        expect(generator.decode(ids[0]).timestamp).toEqual(new Date('2024-03-05T09:20:30Z'));
+        expect(generator.decode(ids[2]).timestamp).toEqual(new Date('2024-03-05T09:20:31Z'));
+        expect(generator.isSorted(ids)).toBe(true);
+
+        expect(generator.decode(generator.generateWithEpochOffset(1500)).timestamp).toEqual(new Date('2024-03-05T10:20:32Z'));
+
+        expect(() => generator.generateWithEpochOffset(-365 * 24 * hour)).toThrow('outside the supported range');
+        expect(() => generator.generateWithEpochOffset(300 * 365 * 24 * hour)).toThrow('outside the supported range');
+        expect(() => generator.generateWithEpochOffset(NaN)).toThrow('finite number of milliseconds');
+    });
+
+    it('should warn when the machine ID part leaves little headroom after chrono overflow', () => {
+        const lopsided = new SortableIDGenerator({ timestampLevel: 'hour', maxSortableRate: MaxSortableRate.Micro1, totalLength: 12 });
+        expect(lopsided['chronoLength']).toBe(6);
+        expect(lopsided['machineIdLength']).toBe(2);
+        const warnings = lopsided.analyzeConfig();
+        expect(warnings.length).toBe(1);
+        expect(warnings[0]).toMatch('Chrono part has 6 symbols but only 2 machine ID symbols');
+
+        expect(new SortableIDGenerator().analyzeConfig()).toEqual([]);
+        expect(new SortableIDGenerator({ timestampLevel: 'hour', maxSortableRate: MaxSortableRate.Micro1, totalLength: 16 }).analyzeConfig()).toEqual([]);
+    });
+
+    it('should compare IDs in constant time with the right result', () => {
+        const generator = new SortableIDGenerator();
+        const id = generator.generate();
+        const other = generator.generate();
+        expect(generator.secureEqual(id, id)).toBe(true);
+        expect(generator.secureEqual(id, String(id))).toBe(true);
+        expect(generator.secureEqual(id, other)).toBe(false);
+        expect(generator.secureEqual(id, id.slice(0, -1) + (id.endsWith('0') ? '1' : '0'))).toBe(false);
+        expect(generator.secureEqual(id, id.slice(1))).toBe(false);
+        expect(generator.secureEqual(id, id.slice(0, -1) + 'é')).toBe(false);
+        expect(generator.secureEqual('', '')).toBe(false);
+
+        const grouping = new SortableIDGenerator({ groupEvery: 4, groupSeparator: '.' });
+        const grouped = grouping.generate();
+        const plain = grouped.replace(/\./g, '');
+        expect(grouping.secureEqual(grouped, grouped)).toBe(true);
+        expect(grouping.secureEqual(grouped, plain)).toBe(true);
+        expect(grouping.secureEqual(plain, grouped)).toBe(true);
+        expect(grouping.secureEqual(grouped, grouping.generate())).toBe(false);
+    });
+
+    it('should draw scratch buffers from a caller-provided pool', async () => {
+        const free: Uint8Array[] = [];
+        let gets = 0;
+        let puts = 0;
+        const bufferPool = {
+            get: (size: number) => {
+                gets++;
+                const buffer = free.pop();
+                return buffer && buffer.length >= size ? buffer : new Uint8Array(size * 2);
+            },
+            put: (buffer: Uint8Array) => {
+                puts++;
+                free.push(buffer);
+            }
+        };
+        const generators = [
+            new SortableIDGenerator({ totalLength: 24, bufferPool, randomMinPrefix: true }),
+            new SortableIDGenerator({ totalLength: 32, bufferPool, poolRefillJitter: true })
+        ];
+
+        // Interleave both generators over one pool
+        const batches = await Promise.all(Array.from({ length: 20 }, async (_, i) => {
+            await new Promise(resolve => setTimeout(resolve, i % 3));
+            const generator = generators[i % 2];
+            return [...generator.sample(10), generator.generate()].map(id => ({ generator, id }));
+        }));
+        const all = batches.flat();
+        expect(new Set(all.map(({ id }) => id)).size).toBe(all.length);
+        for (const { generator, id } of all) {
+            generator.verifyRoundTrip(id);
+        }
+        expect(gets).toBeGreaterThan(0);
+        expect(puts).toBe(gets);
+        expect(free.length).toBeLessThanOrEqual(1);
+
+        // The default machine ID draw goes through the pool too
+        const before = gets;
+        const plain = new SortableIDGenerator({ bufferPool });
+        plain.verifyRoundTrip(plain.generate());
+        expect(gets).toBe(before + 1);
+        expect(puts).toBe(gets);
+
+        // So does the weighted first character, on top of the rest of the machine ID part
+        const weighted = new SortableIDGenerator({ bufferPool, randomWeights: { a: 2, b: 1 } });
+        const beforeWeighted = gets;
+        weighted.verifyRoundTrip(weighted.generate());
+        expect(gets).toBe(beforeWeighted + 2);
+        expect(puts).toBe(gets);
+
+        const tooSmall = new SortableIDGenerator({ bufferPool: { get: () => new Uint8Array(1), put: () => {} } });
+        expect(() => tooSmall.sample(1)).toThrow('Buffer pool returned 1 bytes');
+    });
+
+    it('should construct the nth ID of a unit as the inverse of rankInUnit', () => {
+        const now = new Date('2024-03-05T10:20:30Z');
+        const generator = new SortableIDGenerator({ timestampLevel: 'second', maxSortableRate: MaxSortableRate.Milli10, clock: () => now });
+        // 10,000 IDs per second need 3 chrono symbols in base 64 (64^2 < 10,000 <= 64^3); 200 years of
+        // seconds need 6 timestamp symbols, leaving 32 - 6 - 3 = 23 for the machine ID part
+        const random = 'x'.repeat(23);
+        const slots = 64 ** 3;
+
+        for (const n of [0, 1, 63, 64, 4095, 4096, 9999, slots - 1]) {
+            const id = generator.nthInUnit(now, n, random);
+            expect(generator.rankInUnit(id)).toBe(n);
+            expect(generator.decode(id).timestamp).toEqual(now);
+            expect(generator.decode(id).machineId).toBe(random);
+        }
+
+        // Matches what generate() produces for the same position and random part
+        const first = generator.generate();
+        const second = generator.generate();
+        const machineId = generator.decode(first).machineId;
+        expect(generator.nthInUnit(now, 0, machineId)).toBe(first);
+        expect(generator.nthInUnit(now, 1, machineId)).toBe(second);
+
+        expect(() => generator.nthInUnit(now, slots, random)).toThrow(`Chrono position must be an integer between 0 and ${slots - 1}`);
+        expect(() => generator.nthInUnit(now, 1.5, random)).toThrow('Chrono position');
+        expect(() => generator.nthInUnit(now, 0, 'x')).toThrow(`Machine ID part must be exactly ${random.length} characters`);
+        expect(() => generator.nthInUnit(now, 0, '!'.repeat(random.length))).toThrow('outside the alphabet');
+    });
+
+    it('should call onGenerate with each generated ID and its time', () => {
+        let now = new Date('2024-03-05T10:20:30.123Z');
+        const calls: Array<[string, Date]> = [];
+        const generator = new SortableIDGenerator({
+            clock: () => now,
+            onGenerate: (id, generatedAt) => calls.push([id, generatedAt])
+        });
+
+        const first = generator.generate();
+        now = new Date('2024-03-05T10:20:31.456Z');
+        const { id: second } = generator.generateWithTime();
+        expect(calls).toEqual([[first, new Date('2024-03-05T10:20:30.123Z')], [second, new Date('2024-03-05T10:20:31.456Z')]]);
+        expect(generator.decode(calls[1][0]).timestamp).toEqual(calls[1][1]);
+
+        // Not called when generation fails
+        now = new Date('1999-01-01T00:00:00Z');
+        expect(() => generator.generate()).toThrow();
+        expect(calls.length).toBe(2);
+    });
+
+    it('should append a readable timestamp suffix in debug IDs that decode ignores', () => {
+        const now = new Date('2024-06-01T12:00:00.789Z');
+        const generator = new SortableIDGenerator({ timestampLevel: 'second', clock: () => now });
+
+        const debugId = generator.generateDebug();
+        const [id, suffix] = debugId.split('#');
+        expect(suffix).toBe('2024-06-01T12:00:00.000Z');
+        expect(id.length).toBe(generator['totalLength']);
+        expect(generator.decode(debugId)).toEqual(generator.decode(id));
+        expect(generator.decode(debugId).timestamp.toISOString()).toBe(suffix);
+        // Only decoding strips the suffix: a debug ID is not the stored ID
+        expect(generator.owns(debugId)).toBe(false);
+        expect(generator.secureEqual(debugId, id)).toBe(false);
+        expect(generator.secureEqual(id, id)).toBe(true);
+        expect(() => generator.decode(`${id}#today`)).toThrow("unexpected trailing characters '#today'");
+
+        const hashAlphabet = new SortableIDGenerator({ alphabet: '#0123456789abcdef', totalLength: 24 });
+        expect(() => hashAlphabet.generateDebug()).toThrow("Alphabet contains '#'");
+    });
+
+    it('should estimate string and packed storage sizes', () => {
+        const hex = new SortableIDGenerator({ alphabet: ALPHABET_HEX, totalLength: 16, timestampLevel: 'second' });
+        expect(hex.storageBytes(1000)).toBe(16000);
+        expect(hex.storageEstimate(1000)).toEqual({ stringBytes: 16000, packedBytes: 8000 });
+
+        // Grouped IDs also store their separators: xxxxx-xxxxx-xxxxx-x
+        const grouped = new SortableIDGenerator({
+            alphabet: ALPHABET_HEX, totalLength: 16, timestampLevel: 'second', groupEvery: 5, groupSeparator: '-'
+        });
+        expect(grouped.storageBytes(1)).toBe(grouped.generate().length);
+        expect(grouped.storageEstimate(1000)).toEqual({ stringBytes: 19000, packedBytes: 8000 });
+
+        // The largest packed value needs exactly the estimated bytes
+        const bytesOf = (value: bigint) => Math.ceil(value.toString(2).length / 8);
+        const largest = hex.pack(hex.unpack(BigInt(2) ** BigInt(64) - BigInt(1))) as bigint;
+        expect(bytesOf(largest)).toBe(hex.packedStorageBytes(1));
+        expect(bytesOf(hex.pack(hex.generate()) as bigint)).toBeLessThanOrEqual(hex.packedStorageBytes(1));
+
+        // 62^10 < 2^60
+        const base62 = new SortableIDGenerator({ alphabet: ALPHABET_BASE62, totalLength: 10, timestampLevel: 'hour', maxSortableRate: MaxSortableRate.Hour1 });
+        expect(base62.packedStorageBytes(1)).toBe(8);
+        // 64^21 = 2^126
+        expect(new SortableIDGenerator({ totalLength: 21 }).packedStorageBytes(2)).toBe(32);
+        expect(() => hex.storageEstimate(-1)).toThrow('Count must be a non-negative integer');
+    });
+
+    it('should check a stream of IDs for monotonicity one ID at a time', () => {
+        let now = new Date('2024-03-05T10:20:30Z');
+        const generator = new SortableIDGenerator({ clock: () => now });
+        const ids: string[] = [];
+        for (let i = 0; i < 50; i++) {
+            now = new Date(now.getTime() + (i % 3));
+            ids.push(generator.generate());
+        }
+
+        const checker = generator.monotonicChecker();
+        for (const id of ids) {
+            checker.check(id);
+        }
+        expect(checker.count()).toBe(50);
+
+        const shuffled = [...ids];
+        [shuffled[30], shuffled[31]] = [shuffled[31], shuffled[30]];
+        const failing = generator.monotonicChecker();
+        let error: Error | null = null;
+        for (const id of shuffled) {
+            try {
+                failing.check(id);
+            } catch (caught) {
+                error = caught as Error;
+                break;
+            }
+        }
+        expect(error?.message).toBe(`ID '${ids[30]}' at position 31 sorts before the previous ID '${ids[31]}'`);
+        expect(failing.count()).toBe(31);
+
+        expect(() => generator.monotonicChecker().check('bogus')).toThrow("Invalid ID 'bogus' at position 0");
+    });
+
+    it('should round-trip the configuration through environment variables', () => {
+        const configs = [
+            {},
+            { alphabet: ALPHABET_HEX, totalLength: 24, timestampLevel: 'second' as const, maxSortableRate: MaxSortableRate.Second100 },
+            {
+                alphabet: ALPHABET_BASE62, totalLength: 20, timestampStart: new Date('2020-06-15T12:00:00Z'),
+                timestampEnd: new Date('2060-01-01T00:00:00Z'), maxSortableRate: rateFromPerSecond(250), version: 7,
+                maxChronoLength: 1, counterInRandom: true, signedEpoch: true
+            },
+            { avoidLeadingChars: '-', timestampLevel: 'month' as const, maxSortableRate: MaxSortableRate.Day1, totalLength: 12 },
+            // Only fits because of allowZeroRandom: 13 timestamp + 4 chrono digits
+            { alphabet: '0123456789', totalLength: 17, allowZeroRandom: true },
+            { groupEvery: 4, groupSeparator: '.', totalLength: 24, randomWeights: { a: 2, b: 1 } },
+            // A rate String() writes in exponent notation
+            { timestampLevel: 'second' as const, maxSortableRate: 3.858e-7 },
+            {
+                clusterSize: 8, nodeId: 3, blocklist: ['abc', 'x,y'], randomCharExclude: 'lI1O0', decodeTruncateTo: 'second' as const,
+                trimOnDecode: true, overflowFallback: true
+            }
+        ];
+        for (const config of configs) {
+            const generator = new SortableIDGenerator(config);
+            const env = generator.configEnv();
+            expect(Object.keys(env).every(key => key.startsWith('SORTABLE_NANOID_'))).toBe(true);
+            const restored = SortableIDGenerator.fromEnv(env);
+            expect(restored.equal(generator)).toBe(true);
+            expect(restored.configEnv()).toEqual(env);
+            const id = generator.generate();
+            expect(restored.decode(id)).toEqual(generator.decode(id));
+            // Same output format, e.g. group separators in the same places
+            expect(restored.generate().replace(/[^.]/g, 'x')).toBe(id.replace(/[^.]/g, 'x'));
+        }
+
+        expect(SortableIDGenerator.fromEnv({}).equal(new SortableIDGenerator())).toBe(true);
+        expect(() => SortableIDGenerator.fromEnv({ SORTABLE_NANOID_TOTAL_LENGTH: 'long' }))
+            .toThrow("SORTABLE_NANOID_TOTAL_LENGTH must be a non-negative integer, got 'long'");
+        expect(() => SortableIDGenerator.fromEnv({ SORTABLE_NANOID_TIMESTAMP_START: 'yesterday' })).toThrow('must be an ISO 8601 date');
+        expect(() => SortableIDGenerator.fromEnv({ SORTABLE_NANOID_SIGNED_EPOCH: 'yes' })).toThrow("must be 'true' or 'false'");
+        expect(() => SortableIDGenerator.fromEnv({ SORTABLE_NANOID_BLOCKLIST: 'abc' })).toThrow('must be a JSON array of strings');
+        expect(() => SortableIDGenerator.fromEnv({ SORTABLE_NANOID_MAX_SORTABLE_RATE: '1_per_secnod' }))
+            .toThrow("SORTABLE_NANOID_MAX_SORTABLE_RATE must be a positive number or one of 100_per_microsecond");
+        expect(() => SortableIDGenerator.fromEnv({ SORTABLE_NANOID_MAX_SORTABLE_RATE: '-5' })).toThrow('must be a positive number');
+        expect(SortableIDGenerator.fromEnv({ SORTABLE_NANOID_MAX_SORTABLE_RATE: '2.5e3' }).config().maxSortableRate).toBe(2500);
+        expect(() => SortableIDGenerator.fromEnv({ SORTABLE_NANOID_TIMESTAMP_LEVEL: 'seconds' }))
+            .toThrow("SORTABLE_NANOID_TIMESTAMP_LEVEL must be one of year, month, day, hour, minute, second, millisecond, got 'seconds'");
+        expect(() => SortableIDGenerator.fromEnv({ SORTABLE_NANOID_DECODE_TRUNCATE_TO: 'Hour' })).toThrow('must be one of');
+    });
+
+    it('should compute the minimum alphabet size for a length limit', () => {
+        const YEAR_MS = 31_536_000_000;
+        const DEFAULT_ALPHABET = '0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ-_';
+        const timestampStart = new Date('2024-01-01T00:00:00Z');
+        // Expected bases worked by hand as timestamp + chrono + machine ID symbols, e.g. base 28 at millisecond
+        // level: 28^8 < 1.58e12 ms <= 28^9, 10 IDs per ms fit 1 symbol, and 48 / log2(28) rounds up to 10.
+        // Base 27 would need 11 machine ID symbols (21 in total).
+        const cases: Array<[number, number, TimestampLevel, MaxSortableRate, number, number]> = [
+            [32, 10 * YEAR_MS, 'second', MaxSortableRate.Second100, 64, 10],  // 9 + 3 + 20 = 32
+            [16, YEAR_MS, 'day', MaxSortableRate.Second1, 32, 16],  // 3 + 5 + 8 = 16
+            [20, 50 * YEAR_MS, 'millisecond', MaxSortableRate.Milli10, 48, 28],  // 9 + 1 + 10 = 20
+            [12, 100 * YEAR_MS, 'hour', MaxSortableRate.Hour1, 30, 31]  // 4 + 1 + 7 = 12
+        ];
+        for (const [totalLength, lifespan, level, rate, randomBits, expected] of cases) {
+            const base = minimumBase(totalLength, lifespan, level, rate, randomBits);
+            expect(base).toBe(expected);
+            const alphabet = DEFAULT_ALPHABET.slice(0, base);
+            expect(minimumTotalLength(alphabet, lifespan, level, rate, randomBits)).toBeLessThanOrEqual(totalLength);
+            expect(minimumTotalLength(DEFAULT_ALPHABET.slice(0, base - 1), lifespan, level, rate, randomBits)).toBeGreaterThan(totalLength);
+
+            // A generator with that alphabet fits the requirements into totalLength
+            const generator = new SortableIDGenerator({
+                alphabet, totalLength, timestampLevel: level, maxSortableRate: rate, minEntropyBits: randomBits,
+                timestampStart, timestampEnd: new Date(timestampStart.getTime() + lifespan), clock: () => timestampStart
+            });
+            expect(generator.generate()).toHaveLength(totalLength);
+        }
+        expect(minimumBase(32, 10 * YEAR_MS, 'second', MaxSortableRate.Second100, 64)).toBe(10);
+
+        expect(() => minimumBase(4, YEAR_MS, 'millisecond', MaxSortableRate.Micro1, 128)).toThrow('No alphabet of up to 256 characters');
+        expect(() => minimumBase(0, YEAR_MS, 'second', MaxSortableRate.Second1, 0)).toThrow('Total length must be a positive integer');
+    });
+
+    it('should derive a generator with another clock without affecting the original', () => {
+        const now = new Date('2024-03-05T10:20:30Z');
+        const original = new SortableIDGenerator({ timestampLevel: 'second', version: 2, clock: () => now });
+        const before = original.generate();
+        const config = original.config();
+
+        const later = new Date('2030-01-01T00:00:00Z');
+        const derived = original.withClock(() => later);
+        expect(derived.equal(original)).toBe(true);
+        expect(derived.decode(derived.generate()).timestamp).toEqual(later);
+        expect(derived.nextChronoSlot()).toEqual({ slot: 1, exhausted: false });
+
+        // The original keeps its clock, config and monotonic state
+        expect(original.config()).toEqual(config);
+        expect(original.config().clock).toBe(config.clock);
+        const after = original.generate();
+        expect(original.decode(after).timestamp).toEqual(now);
+        expect(original.rankInUnit(after)).toBe(original.rankInUnit(before) + 1);
+    });
+
+    it('should keep IDs strictly increasing when a burst overflows the chrono part', () => {
+        let now = new Date('2024-03-05T10:20:30Z');
+        const generator = new SortableIDGenerator({
+            alphabet: ALPHABET_HEX,
+            totalLength: 14,
+            timestampLevel: 'second',
+            maxSortableRate: MaxSortableRate.Second1,
+            randomFunc: (length: number) => '8'.repeat(length),  // Far enough from the top not to run out
+            clock: () => now
+        });
+        expect(generator['chronoLength']).toBe(1);
+
+        const ids: string[] = [];
+        for (let unit = 0; unit < 3; unit++) {
+            now = new Date(Date.UTC(2024, 2, 5, 10, 20, 30 + unit));
+            // 16 chrono slots, then 34 more IDs carried by the machine ID part
+            for (let i = 0; i < 50; i++) {
+                ids.push(generator.generate());
+            }
+        }
+        for (let i = 1; i < ids.length; i++) {
+            expect(ids[i] > ids[i - 1]).toBe(true);
+        }
+        expect(new Set(ids).size).toBe(ids.length);
+        expect(generator.decode(ids[49]).chronoPart).toBe('f');
+        expect(generator.decode(ids[50]).chronoPart).toBe('0');
+
+        // The node prefix stays put while the machine ID part carries the burst
+        const clustered = new SortableIDGenerator({
+            alphabet: ALPHABET_HEX, totalLength: 14, timestampLevel: 'second', maxSortableRate: MaxSortableRate.Second1,
+            clusterSize: 16, nodeId: 9, randomFunc: (length: number) => 'f'.repeat(length), clock: () => now
+        });
+        for (let i = 0; i < 16; i++) {
+            clustered.generate();
+        }
+        expect(() => clustered.generate()).toThrow('Generation rate exceeded');
+        expect(clustered.decode(clustered['lastId']).nodeId).toBe(9);
+    });
+
+    it('should decode self-describing IDs of different lengths from the same family', () => {
+        const now = new Date('2024-03-05T10:20:30Z');
+        const timestampStart = new Date('2024-01-01T00:00:00Z');
+        const family = [
+            { totalLength: 16, timestampEnd: new Date('2030-01-01T00:00:00Z') },
+            { totalLength: 24 },
+            { totalLength: 40, timestampEnd: new Date('3000-01-01T00:00:00Z') }
+        ].map(config => new SortableIDGenerator({
+            ...config, alphabet: ALPHABET_BASE62, timestampStart, timestampLevel: 'second', selfDescribing: true, clock: () => now
+        }));
+        const lengths = new Set(family.map(generator => generator['timestampLength']));
+        expect(lengths.size).toBeGreaterThan(1);
+
+        for (const generator of family) {
+            const id = generator.generate();
+            expect(id[0]).toBe(ALPHABET_BASE62[generator['timestampLength']]);
+            expect(decodeSelfDescribing(id, ALPHABET_BASE62, timestampStart, 'second')).toEqual(now);
+            expect(generator.decode(id).timestamp).toEqual(now);
+        }
+
+        const months = new SortableIDGenerator({
+            timestampStart, timestampLevel: 'month', maxSortableRate: MaxSortableRate.Day1, totalLength: 10, selfDescribing: true, clock: () => now
+        });
+        const monthId = months.generate();
+        expect(decodeSelfDescribing(monthId, months['alphabet'], timestampStart, 'month')).toEqual(months.decode(monthId).timestamp);
+
+        // No machine ID part: length character, 9 timestamp symbols (16^8 < 200 years of seconds <= 16^9) and 1 chrono symbol
+        const zeroRandom = new SortableIDGenerator({
+            alphabet: ALPHABET_HEX, totalLength: 11, timestampStart, timestampLevel: 'second', maxSortableRate: MaxSortableRate.Second1,
+            allowZeroRandom: true, selfDescribing: true, clock: () => now
+        });
+        const zeroRandomId = zeroRandom.generate();
+        expect(zeroRandom.decode(zeroRandomId).machineId).toBe('');
+        expect(decodeSelfDescribing(zeroRandomId, ALPHABET_HEX, timestampStart, 'second')).toEqual(now);
+
+        // The length character must be consistent with the generator and fit in the ID
+        const [short, long] = [family[0].generate(), family[2].generate()];
+        expect(() => family[0].decode(long[0] + short.slice(1))).toThrow('ID describes a timestamp length of');
+        expect(() => decodeSelfDescribing('z' + short.slice(1), ALPHABET_BASE62, timestampStart, 'second')).toThrow("doesn't fit in 16 characters");
+        expect(() => decodeSelfDescribing('a#', ALPHABET_BASE62, timestampStart, 'second')).toThrow('characters of the alphabet');
+        expect(() => new SortableIDGenerator({ selfDescribing: true, version: 1 })).toThrow('selfDescribing cannot be combined with version');
+    });
+
+    it('should draw the first random character with the configured weights', () => {
+        const randomWeights = { '0': 1, '1': 2, '2': 5, 'f': 0 };
+        const generator = new SortableIDGenerator({ alphabet: ALPHABET_HEX, totalLength: 24, randomWeights });
+        const machineIdStart = 24 - generator.decode(generator.generate()).machineId.length;
+
+        const counts: Record<string, number> = {};
+        // IDs generated within one time unit share their machine ID part, so count independent samples
+        const ids = generator.sample(8000);
+        for (const id of ids) {
+            counts[id[machineIdStart]] = (counts[id[machineIdStart]] || 0) + 1;
+        }
+        expect(Object.keys(counts).sort()).toEqual(['0', '1', '2']);
+        // Expected shares 1/8, 2/8 and 5/8, within a few standard deviations
+        expect(Math.abs(counts['0'] / ids.length - 0.125)).toBeLessThan(0.025);
+        expect(Math.abs(counts['1'] / ids.length - 0.25)).toBeLessThan(0.025);
+        expect(Math.abs(counts['2'] / ids.length - 0.625)).toBeLessThan(0.025);
+        // The rest of the machine ID part stays uniform
+        expect(new Set(ids.map(id => id[machineIdStart + 1])).size).toBe(16);
+        expect('012').toContain(generator.generate()[machineIdStart]);
+
+        expect(() => new SortableIDGenerator({ alphabet: ALPHABET_HEX, totalLength: 24, randomWeights: { 'g': 1 } }))
+            .toThrow("randomWeights key 'g' is not a character of the random alphabet");
+        expect(() => new SortableIDGenerator({ randomWeights: { 'a': 0 } })).toThrow('must add up to between 1 and 2^32');
+        expect(() => new SortableIDGenerator({ randomWeights: { 'a': 1.5 } })).toThrow("weight for 'a' must be a non-negative integer");
+        expect(() => new SortableIDGenerator({ randomWeights: { 'a': 1 }, randomMinPrefix: true })).toThrow('cannot be combined');
+    });
+
+    it('should keep the weighted first random character when the chrono part overflows', () => {
+        const now = new Date('2024-03-05T10:20:30Z');
+        const generator = new SortableIDGenerator({
+            alphabet: ALPHABET_HEX,
+            totalLength: 12,
+            timestampLevel: 'second',
+            maxSortableRate: MaxSortableRate.Second1,
+            randomWeights: { 'e': 1 },
+            // 16 chrono slots, then the second machine ID character counts up from 0
+            randomFunc: length => '0'.repeat(length),
+            clock: () => now
+        });
+
+        const ids = Array.from({ length: 31 }, () => generator.generate());
+        expect(ids.map(id => generator.decode(id).machineId)).toEqual([
+            ...Array(16).fill('e0'),
+            ...[...'123456789abcdef'].map(char => `e${char}`)
+        ]);
+        expect(generator.isSorted(ids)).toBe(true);
+        // Carrying into the first character would make it 'f', which has no weight
+        expect(() => generator.generate()).toThrow('Generation rate exceeded');
+    });
+
+    it('should fall back to the next time unit instead of failing under a burst', () => {
+        let now = new Date('2024-03-05T10:20:30Z');
+        const generator = new SortableIDGenerator({
+            alphabet: ALPHABET_HEX,
+            totalLength: 12,
+            timestampLevel: 'second',
+            maxSortableRate: MaxSortableRate.Second1,
+            overflowFallback: true,
+            // 16 chrono slots, and a maximal machine ID part leaves it no room to take over
+            randomFunc: length => 'f'.repeat(length),
+            clock: () => now
+        });
+
+        const results = Array.from({ length: 40 }, () => generator.generateWithFallback());
+        const ids = results.map(({ id }) => id);
+        expect(ids.every(id => id.length === 12)).toBe(true);
+        expect(new Set(ids).size).toBe(40);
+        expect(generator.isSorted(ids)).toBe(true);
+        expect(results[15].warning).toBeUndefined();
+        expect(results[16].warning).toMatch('ahead of the clock');
+        expect(results[17].warning).toBeUndefined();
+        expect(generator.decode(ids[16]).timestamp).toEqual(new Date('2024-03-05T10:20:31Z'));
+        expect(generator.decode(ids[39]).timestamp).toEqual(new Date('2024-03-05T10:20:32Z'));
+
+        // Once the clock catches up, IDs follow it again
+        now = new Date('2024-03-05T10:20:40Z');
+        const caughtUp = generator.generate();
+        expect(caughtUp > ids[39]).toBe(true);
+        expect(generator.decode(caughtUp).timestamp).toEqual(now);
+
+        const strict = new SortableIDGenerator({
+            alphabet: ALPHABET_HEX, totalLength: 12, timestampLevel: 'second', maxSortableRate: MaxSortableRate.Second1,
+            randomFunc: length => 'f'.repeat(length), clock: () => now
+        });
+        expect(() => Array.from({ length: 17 }, () => strict.generate())).toThrow('Generation rate exceeded');
+
+        // Only a fallback holds a unit ahead of the clock, not an ID generated with an epoch offset
+        const shifting = new SortableIDGenerator({ timestampLevel: 'second', overflowFallback: true, clock: () => now });
+        const ahead = shifting.generateWithEpochOffset(60_000);
+        expect(shifting.decode(ahead).timestamp).toEqual(new Date(now.getTime() + 60_000));
+        expect(shifting.decode(shifting.generate()).timestamp).toEqual(now);
+        expect(shifting.decode(shifting.generateWithEpochOffset(-60_000)).timestamp).toEqual(new Date(now.getTime() - 60_000));
+        expect(shifting.generateWithFallback().warning).toBeUndefined();
+    });
+
+    it('should peek at the ID overflowFallback would generate', () => {
+        const now = new Date('2024-03-05T10:20:30Z');
+        const generator = new SortableIDGenerator({
+            alphabet: ALPHABET_HEX,
+            totalLength: 12,
+            timestampLevel: 'second',
+            maxSortableRate: MaxSortableRate.Second1,
+            overflowFallback: true,
+            randomFunc: length => 'f'.repeat(length),
+            clock: () => now
+        });
+        for (let i = 0; i < 16; i++) {
+            generator.generate();
+        }
+
+        // Exhausted unit: the next ID falls back to the following one, and later ones stay there
+        for (let i = 0; i < 3; i++) {
+            const peeked = generator.peek();
+            expect(generator.decode(peeked).timestamp).toEqual(new Date('2024-03-05T10:20:31Z'));
+            expect(generator.generate()).toBe(peeked);
+        }
+    });
+
+    it('should compute the timestamp length each level needs for known ranges', () => {
+        // Expected lengths are worked by hand: the smallest n with base^n >= the number of units in the range
+        const table: { level: TimestampLevel; alphabet: string; start: Date; end: Date; expected: number }[] = [
+            // 2024-2224 has 48 leap days: 73,048 days = 6,311,347,200,000 ms, 64^7 < it <= 64^8
+            { level: 'millisecond', alphabet: ALPHABET_URL_PATH_SAFE, start: new Date(Date.UTC(2024, 0, 1)), end: new Date(Date.UTC(2224, 0, 1)), expected: 8 },
+            // 1,000 ms is exactly 10^3, so values 0..999 fit in three digits
+            { level: 'millisecond', alphabet: '0123456789', start: new Date(Date.UTC(2024, 0, 1)), end: new Date(Date.UTC(2024, 0, 1, 0, 0, 1)), expected: 3 },
+            // 2024 is a leap year: 366 * 86,400 = 31,622,400 s, 10^7 < it <= 10^8
+            { level: 'second', alphabet: '0123456789', start: new Date(Date.UTC(2024, 0, 1)), end: new Date(Date.UTC(2025, 0, 1)), expected: 8 },
+            // 9 s is exactly 3^2
+            { level: 'second', alphabet: '012', start: new Date(Date.UTC(2024, 0, 1)), end: new Date(Date.UTC(2024, 0, 1, 0, 0, 9)), expected: 2 },
+            // 3,653 days * 1,440 = 5,260,320 minutes, 16^5 < it <= 16^6
+            { level: 'minute', alphabet: ALPHABET_HEX, start: new Date(Date.UTC(2024, 0, 1)), end: new Date(Date.UTC(2034, 0, 1)), expected: 6 },
+            // 16 hours is exactly 2^4
+            { level: 'hour', alphabet: '01', start: new Date(Date.UTC(2024, 0, 1)), end: new Date(Date.UTC(2024, 0, 1, 16)), expected: 4 },
+            // 17 hours needs a fifth bit
+            { level: 'hour', alphabet: '01', start: new Date(Date.UTC(2024, 0, 1)), end: new Date(Date.UTC(2024, 0, 1, 17)), expected: 5 },
+            // 2024-2124 has 24 leap days: 36,524 days, 36^2 < it <= 36^3
+            { level: 'day', alphabet: ALPHABET_DNS_SAFE, start: new Date(Date.UTC(2024, 0, 1)), end: new Date(Date.UTC(2124, 0, 1)), expected: 3 },
+            // 1,200 calendar months, 12^2 < it <= 12^3
+            { level: 'month', alphabet: '0123456789ab', start: new Date(2024, 0, 1), end: new Date(2124, 0, 1), expected: 3 },
+            // 27 calendar months is exactly 3^3
+            { level: 'month', alphabet: '012', start: new Date(2024, 0, 1), end: new Date(2026, 3, 1), expected: 3 },
+            // 100 calendar years is exactly 10^2
+            { level: 'year', alphabet: '0123456789', start: new Date(2024, 0, 1), end: new Date(2124, 0, 1), expected: 2 },
+            // 1,000 calendar years is exactly 10^3
+            { level: 'year', alphabet: '0123456789', start: new Date(2000, 0, 1), end: new Date(3000, 0, 1), expected: 3 },
+        ];
+        for (const { level, alphabet, start, end, expected } of table) {
+            // Pin the clock to the start so the short historical ranges are still accepted, and keep the rate
+            // low so the tiny alphabets have room for a chrono part
+            const generator = new SortableIDGenerator({
+                alphabet, timestampLevel: level, timestampStart: start, timestampEnd: end, maxSortableRate: 1, clock: () => start
+            });
+            expect(generator['timestampLength']).toBe(expected);
+        }
+    });
+
+    it('should count the IDs issuable between two IDs', () => {
+        // 13 timestamp + 4 chrono decimal digits and no machine ID part, so every slot is exactly one ID
+        let now = new Date('2024-03-05T10:20:30.456Z');
+        const generator = new SortableIDGenerator({ alphabet: '0123456789', totalLength: 17, allowZeroRandom: true, clock: () => now });
+        const ids = Array.from({ length: 5 }, () => generator.generate());
+        now = new Date('2024-03-05T10:20:30.457Z');
+        ids.push(generator.generate());
+
+        expect(generator.countBetween(ids[0], ids[0])).toBe(BigInt(1));
+        expect(generator.countBetween(ids[1], ids[4])).toBe(BigInt(4));
+        // All 10,000 chrono values of the first millisecond, then the first of the next
+        expect(generator.countBetween(ids[0], ids[5])).toBe(BigInt(10_001));
+
+        expect(() => generator.countBetween(ids[4], ids[1])).toThrow(`ID '${ids[4]}' sorts after '${ids[1]}'`);
+        expect(() => generator.countBetween(ids[0], 'not-an-id')).toThrow('characters long');
+    });
+
+    it('should encrypt IDs into a reversible public form', () => {
+        const encryptionKey = Uint8Array.from(Buffer.from('2B7E151628AED2A6ABF7158809CF4F3C', 'hex'));
+        const generator = new SortableIDGenerator({ encryptionKey });
+        const ids = Array.from({ length: 20 }, () => generator.generate());
+        const publicIds = ids.map(id => generator.encrypt(id));
+
+        for (const [i, publicId] of publicIds.entries()) {
+            expect(publicId).toHaveLength(32);
+            expect(publicId).not.toBe(ids[i]);
+            expect(generator.decrypt(publicId)).toBe(ids[i]);
+            expect(generator.decodeEncrypted(publicId)).toEqual(generator.decode(ids[i]));
+        }
+        // IDs from the same millisecond share their timestamp, but their public forms don't
+        const timestampLength = generator['timestampLength'];
+        expect(new Set(publicIds.map(id => id.slice(0, timestampLength))).size).toBeGreaterThan(1);
+        // A debug ID encrypts as the ID before its suffix
+        const debugId = generator.generateDebug();
+        expect(generator.decrypt(generator.encrypt(debugId))).toBe(debugId.split('#')[0]);
+
+        const otherKey = new SortableIDGenerator({ encryptionKey: new Uint8Array(16) });
+        let recovered: string | null = null;
+        try {
+            recovered = otherKey.decrypt(publicIds[0]);
+        } catch {
+            // Most wrong-key results aren't valid IDs
+        }
+        expect(recovered).not.toBe(ids[0]);
+        expect(() => generator.decrypt('short')).toThrow('Encrypted ID must be 32 characters long');
+        expect(() => new SortableIDGenerator().encrypt(ids[0])).toThrow('needs an encryptionKey');
+        expect(() => new SortableIDGenerator({ encryptionKey: new Uint8Array(8) })).toThrow('16, 24 or 32 bytes');
+    });
+
+    it('should report the precision of decoded timestamps per level', () => {
+        const expected: Record<TimestampLevel, number | undefined> = {
+            millisecond: 1,
+            second: 1_000,
+            minute: 60_000,
+            hour: 3_600_000,
+            day: 86_400_000,
+            // Calendar units have no single length
+            month: undefined,
+            year: undefined
+        };
+        for (const [level, precision] of Object.entries(expected) as [TimestampLevel, number | undefined][]) {
+            const generator = new SortableIDGenerator({ timestampLevel: level, maxSortableRate: 1 });
+            expect(generator.decodePrecision()).toBe(precision);
+            expect(generator.printInfo().decodePrecision).toBe(precision);
+        }
+        expect(new SortableIDGenerator({ decodeTruncateTo: 'minute' }).decodePrecision()).toBe(60_000);
+        expect(new SortableIDGenerator({ timestampLevel: 'day', decodeTruncateTo: 'month' }).decodePrecision()).toBeUndefined();
+
+        const log = jest.spyOn(console, 'log').mockImplementation(() => {});
+        new SortableIDGenerator({ timestampLevel: 'second', maxSortableRate: 1 }).printInfo();
+        new SortableIDGenerator({ timestampLevel: 'month', maxSortableRate: MaxSortableRate.Day1 }).printInfo();
+        expect(log).toHaveBeenCalledWith('Decode Precision: 1000 ms');
+        expect(log).toHaveBeenCalledWith('Decode Precision: one calendar month (varies in length)');
+        log.mockRestore();
+    });
+
+    it('should decode just the timestamp value on the fast path', () => {
+        for (const config of [{}, { version: 3 }, { signedEpoch: true }, { selfDescribing: true, timestampLevel: 'second' as TimestampLevel }]) {
+            const generator = new SortableIDGenerator(config);
+            const id = generator.generate();
+            expect(generator.decodeTimespanFast(id)).toBe(generator.decodeComponents(id).timestampValue);
+        }
+
+        const generator = new SortableIDGenerator({ version: 3 });
+        const id = generator.generate();
+        expect(generator.decodeTimespanFast(id.slice(1))).toBeNull();
+        expect(generator.decodeTimespanFast(`${id.slice(0, -1)}!`)).toBeNull();
+        expect(generator.decodeTimespanFast(`${id.slice(0, -1)}é`)).toBeNull();
+        expect(generator.decodeTimespanFast(new SortableIDGenerator({ version: 4 }).generate())).toBeNull();
+    });
+
+    it('should order IDs within a millisecond by their sub-millisecond generation time', () => {
+        const base = Date.UTC(2024, 5, 1, 12);
+        let preciseMs = base;
+        const config = { subUnitChrono: true, preciseClock: () => preciseMs };
+        const a = new SortableIDGenerator(config);
+        const b = new SortableIDGenerator(config);
+
+        // Two generators interleaving within one millisecond: plain counters would both start at 0
+        const generated: string[] = [];
+        for (const [generator, offset] of [[a, 0.1], [b, 0.3], [a, 0.5], [b, 0.7], [a, 0.9]] as [SortableIDGenerator, number][]) {
+            preciseMs = base + offset;
+            generated.push(generator.generate());
+        }
+        expect([...generated].sort()).toEqual(generated);
+
+        const decoded = a.decode(generated[2]);
+        expect(decoded.timestamp).toEqual(new Date(base));
+        expect(decoded.subUnitOffset).toBeCloseTo(0.5, 3);
+
+        // Ties fall back to counting up
+        preciseMs = base + 0.95;
+        const first = a.generate();
+        const second = a.generate();
+        expect(second > first).toBe(true);
+        expect(a.rankInUnit(second)).toBe(a.rankInUnit(first) + 1);
+        expect(new SortableIDGenerator().decode(first).subUnitOffset).toBeUndefined();
+
+        // peek() previews the same sub-unit chrono part generate() then uses
+        preciseMs = base + 1.6;
+        const peeked = a.peek();
+        expect(a.generate()).toBe(peeked);
+        expect(a.decode(peeked).subUnitOffset).toBeCloseTo(0.6, 3);
+    });
+
+    it('should read every entry point from preciseClock with subUnitChrono', () => {
+        // preciseClock runs 700 ms behind clock, so reading both would straddle two seconds
+        let preciseMs = Date.UTC(2024, 5, 1, 12, 0, 0, 800);
+        const generator = new SortableIDGenerator({
+            timestampLevel: 'second',
+            subUnitChrono: true,
+            clock: () => new Date(preciseMs + 700),
+            preciseClock: () => preciseMs
+        });
+
+        const ids: string[] = [];
+        for (let i = 0; i < 6; i++) {
+            preciseMs += 10;
+            if (i % 2 === 0) {
+                ids.push(generator.generate());
+            } else {
+                const { id, generatedAt } = generator.generateWithTime();
+                expect(generatedAt).toEqual(new Date(Math.floor(preciseMs)));
+                ids.push(id);
+            }
+        }
+        expect(generator.isSorted(ids)).toBe(true);
+        expect(new Set(ids).size).toBe(ids.length);
+        ids.forEach(id => expect(generator.decode(id).timestamp).toEqual(new Date(Date.UTC(2024, 5, 1, 12))));
+    });
+
+    it('should group IDs from every method that returns one', () => {
+        const now = new Date('2024-03-05T10:20:30Z');
+        const generator = new SortableIDGenerator({
+            alphabet: ALPHABET_BASE62,
+            totalLength: 16,
+            timestampLevel: 'second',
+            groupEvery: 4,
+            groupSeparator: '-',
+            clock: () => now
+        });
+        const grouped = /^[0-9A-Za-z]{4}-[0-9A-Za-z]{4}-[0-9A-Za-z]{4}-[0-9A-Za-z]{4}$/;
+
+        const peeked = generator.peek();
+        const id = generator.generate();
+        expect(peeked).toMatch(grouped);
+        expect(id.startsWith(generator.timestampPrefix(now))).toBe(true);
+        const { lower, upper } = generator.rangeBounds(now, now);
+        expect(lower < id && id < upper).toBe(true);
+
+        const { startId, endId } = generator.reserveBlock(now, 2);
+        const others = [
+            lower, upper, startId, endId,
+            generator.generateAt(now),
+            generator.generateFromSequence(7),
+            generator.nthInUnit(now, 3, '0'.repeat(generator['machineIdLength'])),
+            generator.reroll(id),
+            ...generator.sample(3)
+        ];
+        for (const other of others) {
+            expect(other).toMatch(grouped);
+            generator.decode(other);
+        }
+
+        const tiny = new SortableIDGenerator({
+            alphabet: '0123',
+            totalLength: 14,
+            timestampStart: new Date('2024-01-01T00:00:00Z'),
+            timestampLevel: 'day',
+            maxSortableRate: MaxSortableRate.Day1,
+            groupEvery: 5,
+            groupSeparator: '-',
+            clock: () => now
+        });
+        const tinyId = tiny.generate();
+        expect(tiny.unpack(tiny.pack(tinyId)!)).toBe(tinyId);
+        expect([...tiny.enumerateUnit(now)]).toContain(tinyId);
+    });
+});
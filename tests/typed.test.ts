@@ -0,0 +1,20 @@
+import { TypedGenerator } from '../src/typed';
+import type { TypedID } from '../src/typed';
+
+type UserID = TypedID<'user'>;
+
+describe('TypedGenerator', () => {
+    it('should generate and decode branded IDs', () => {
+        const users = new TypedGenerator<'user'>();
+        const id: UserID = users.generate();
+        expect(typeof id).toBe('string');
+        expect(users.decode(id).timestamp).toBeInstanceOf(Date);
+    });
+
+    it('should only brand IDs that decode', () => {
+        const users = new TypedGenerator<'user'>();
+        const id = users.generate();
+        expect(users.parse(`${id}`)).toBe(id);
+        expect(() => users.parse('not-an-id')).toThrow('characters long');
+    });
+});